@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// dapPortable translates portable (any) commands into the DAP requests
+// that answer them. (dap) commands are expressions for evaluate.
+var dapPortable = map[string]string{
+	"print":  "evaluate %s",
+	"locals": "variables",
+	"bt":     "stackTrace",
+}
+
+// Dap is a generic Debug Adapter Protocol client, which tests what an
+// IDE would show. The adapter must speak DAP on its standard input and
+// output, as lldb-dap does. Each target gets a fresh adapter process.
+type Dap struct {
+	Command  []string // adapter command line
+	Path     string   // path to the adapter
+	Template *template.Template
+
+	// As, if set, is the debugger the adapter stands in for, whose name
+	// the results are reported under. Its commands, such as (lldb) ones,
+	// are evaluated in the adapter's REPL, prefixed with ReplPrefix.
+	As         string
+	ReplPrefix string
+
+	normalize bool // the plan's ScriptContext.Normalize, set by Run
+}
+
+// newLldbDap returns an lldb backend that drives lldb-dap, or lldb-vscode
+// as it used to be called, from Go. Unlike the lldb script, it doesn't
+// depend on a Python that matches lldb's Python module.
+func newLldbDap() *Dap {
+	command := "lldb-dap"
+	if _, err := exec.LookPath(command); err != nil {
+		if _, err := exec.LookPath("lldb-vscode"); err == nil {
+			command = "lldb-vscode"
+		}
+	}
+	return &Dap{Command: []string{command}, As: "lldb", ReplPrefix: "`"}
+}
+
+func (d *Dap) Init() error {
+	if len(d.Command) == 0 {
+		return fmt.Errorf("no adapter command")
+	}
+	path, err := exec.LookPath(d.Command[0])
+	if err != nil {
+		return err
+	}
+	d.Path = path
+	d.Template = newScriptTemplate(d, planTemplate)
+	return nil
+}
+
+func (d *Dap) Run(executable string, scriptPath string, stdout, stderr io.Writer) error {
+	dot, err := readPlan(scriptPath)
+	if err != nil {
+		return err
+	}
+	d.normalize = dot.Normalize
+	for _, t := range dot.Targets {
+		if err := d.runAdapter(t, dot.Audit, stdout, stderr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runAdapter runs the tests for t, or audits it, in a new adapter
+// process. A non-nil error means that the adapter failed.
+func (d *Dap) runAdapter(t *Target, audit bool, stdout, stderr io.Writer) error {
+	cmd := exec.Command(d.Path, d.Command[1:]...)
+	cmd.Stderr = stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Requests and their responses both go to the transcript.
+	c := &dapConn{
+		w:          io.MultiWriter(in, stdout),
+		r:          bufio.NewReader(io.TeeReader(out, stdout)),
+		transcript: stdout,
+	}
+	run := d.runTarget
+	if audit {
+		run = d.auditTarget
+	}
+	if err := run(c, t); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	in.Close()
+	return cmd.Wait()
+}
+
+// dapFrame is a StackFrame.
+type dapFrame struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Line   int    `json:"line"`
+	Source struct {
+		Path string `json:"path"`
+	} `json:"source"`
+}
+
+// dapBreakpoint is a Breakpoint, as returned by setBreakpoints.
+// Line is where the adapter put it, which for a BREAKPOINT comment
+// is the next line with code.
+type dapBreakpoint struct {
+	ID                   int    `json:"id"`
+	Line                 int    `json:"line"`
+	Verified             bool   `json:"verified"`
+	Message              string `json:"message"`
+	InstructionReference string `json:"instructionReference"`
+}
+
+// initialize begins the session with the adapter.
+func (d *Dap) initialize(c *dapConn) error {
+	return c.request("initialize", map[string]interface{}{
+		"clientID":        "debugo",
+		"adapterID":       "debugo",
+		"linesStartAt1":   true,
+		"columnsStartAt1": true,
+		"pathFormat":      "path",
+	}, nil)
+}
+
+// setBreakpoints sets the breakpoints in the source file at path to
+// those at lines, returning them in the same order.
+func (d *Dap) setBreakpoints(c *dapConn, path string, lines []int) ([]dapBreakpoint, error) {
+	var args []map[string]int
+	for _, line := range lines {
+		args = append(args, map[string]int{"line": line})
+	}
+	var resp struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	err := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": args,
+	}, &resp)
+	return resp.Breakpoints, err
+}
+
+// auditTarget reports the addresses the adapter resolves t's BREAKPOINT
+// lines to. DAP gives a breakpoint at most one address, its
+// instructionReference, so a line with several shows as one; adapters
+// that give none show "verified".
+func (d *Dap) auditTarget(c *dapConn, t *Target) error {
+	if err := d.initialize(c); err != nil {
+		return err
+	}
+	rc, err := dialReport(t.Sock, t.RunID, d.Name(), strings.Join(d.Command, " "), c.transcript)
+	if err != nil {
+		return err
+	}
+	// Breakpoints can only be set once the program is launched, but
+	// it never runs: the session ends before configuration is done.
+	if _, err := c.start("launch", map[string]interface{}{"program": t.Executable, "cwd": t.RunDir, "mode": "exec"}); err != nil {
+		return err
+	}
+	if _, err := c.waitEvent("initialized"); err != nil {
+		return err
+	}
+
+	bps := make(map[string][]Breakpoint) // by file
+	for _, bp := range t.Breakpoints {
+		if bp.Kind == "" {
+			path, _ := filepath.Abs(bp.Filename)
+			bps[path] = append(bps[path], bp)
+		}
+	}
+	for path, order := range bps {
+		var lines []int
+		for _, bp := range order {
+			lines = append(lines, bp.Line)
+		}
+		resp, err := d.setBreakpoints(c, path, lines)
+		if err != nil {
+			rc.send(TestResult{Status: "ERROR", File: order[0].Filename, Line: order[0].Line, Msg: "failed to set breakpoints: " + err.Error()})
+			continue
+		}
+		for i, bp := range order {
+			res := TestResult{Status: "LOCATIONS", File: bp.Filename, Line: bp.Line}
+			switch {
+			case i >= len(resp):
+			case resp[i].Verified && resp[i].InstructionReference != "":
+				res.Addresses = []string{resp[i].InstructionReference}
+			case resp[i].Verified:
+				res.Addresses = []string{"verified"}
+			default:
+				res.Msg = resp[i].Message
+			}
+			if err := rc.send(res); err != nil {
+				return err
+			}
+		}
+	}
+	c.request("disconnect", map[string]interface{}{"terminateDebuggee": true}, nil)
+	return rc.end()
+}
+
+// runTarget runs the tests for t, reporting to t.Sock.
+func (d *Dap) runTarget(c *dapConn, t *Target) error {
+	if err := d.initialize(c); err != nil {
+		return err
+	}
+
+	rc, err := dialReport(t.Sock, t.RunID, d.Name(), strings.Join(d.Command, " "), c.transcript)
+	if err != nil {
+		return err
+	}
+
+	// abort reports an error and ends the run.
+	abort := func(filename string, lineno int, msg string) error {
+		rc.send(TestResult{Status: "ERROR", File: filename, Line: lineno, Msg: msg})
+		c.request("disconnect", map[string]interface{}{"terminateDebuggee": true}, nil)
+		return rc.end()
+	}
+
+	// Adapters differ in whether they answer launch before or after
+	// configuration is done, so only wait for the response afterwards.
+	// "mode" is for dlv; other adapters ignore it. The environment is
+	// added to the adapter's own, which the program inherits.
+	env := make(map[string]string)
+	for _, kv := range t.Env {
+		env[envName(kv)] = strings.TrimPrefix(kv[len(envName(kv)):], "=")
+	}
+	launchArgs := map[string]interface{}{
+		"program": t.Executable,
+		"args":    append([]string{}, t.Args...),
+		"env":     env,
+		"cwd":     t.RunDir,
+		"mode":    "exec",
+	}
+	if t.Stdin != "" {
+		launchArgs["stdio"] = []interface{}{t.Stdin, nil, nil} // lldb-dap
+	}
+	launch, err := c.start("launch", launchArgs)
+	if err != nil {
+		return err
+	}
+	if _, err := c.waitEvent("initialized"); err != nil {
+		return err
+	}
+
+	// Breakpoints to set, by file.
+	bps := make(map[string][]Breakpoint)
+	for _, bp := range t.Breakpoints {
+		// Loading cores and attaching are specific to each
+		// adapter, so CORE and ATTACH markers are not tested.
+		// PANIC and SIGNAL markers are handled below.
+		if len(bp.Tests) == 0 || bp.Kind != "" {
+			if bp.Kind == "core" || bp.Kind == "attach" {
+				msg := fmt.Sprintf("%s markers are not supported by %s", strings.ToUpper(bp.Kind), d.adapter())
+				if err := rc.send(TestResult{Status: "SKIP", File: bp.Filename, Line: bp.Line, Msg: msg}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		path, _ := filepath.Abs(bp.Filename)
+		bps[path] = append(bps[path], bp)
+	}
+	// The breakpoints set, by the adapter's ID and by where it put
+	// them, to recognize the stops from adapters that don't report
+	// the IDs hit. Like the scripts' breakpoints, they are temporary:
+	// tests run on the first hit only.
+	set := newDapBreakpoints()
+	for path, order := range bps {
+		var lineNos []int
+		for _, bp := range order {
+			lineNos = append(lineNos, bp.Line)
+		}
+		resp, err := d.setBreakpoints(c, path, lineNos)
+		if err != nil {
+			return abort(order[0].Filename, order[0].Line, "failed to set breakpoints: "+err.Error())
+		}
+		for i, bp := range order {
+			switch {
+			case i >= len(resp):
+				rc.send(TestResult{Status: "ERROR", File: bp.Filename, Line: bp.Line, Msg: "breakpoint not set"})
+			case !resp[i].Verified:
+				rc.send(TestResult{Status: "ERROR", File: bp.Filename, Line: bp.Line, Msg: "breakpoint not verified: " + resp[i].Message})
+			default:
+				set.add(path, resp[i], bp)
+			}
+		}
+	}
+
+	// A PANIC marker's tests run at a function breakpoint on
+	// runtime.gopanic, and a SIGNAL marker's when the adapter
+	// reports the signal as an exception.
+	crash := t.Crash()
+	if crash != nil && crash.Kind == "panic" {
+		if err := d.setPanicBreakpoint(c, true); err != nil {
+			return abort(crash.Filename, crash.Line, "failed to set breakpoint on runtime.gopanic: "+err.Error())
+		}
+	}
+
+	if err := c.request("configurationDone", nil, nil); err != nil {
+		return abort("", 0, err.Error())
+	}
+	if err := c.response(launch, nil); err != nil {
+		return abort("", 0, "failed to launch: "+err.Error())
+	}
+
+	// The program's output arrives in output events.
+	streams := make(map[string]*os.File)
+	for _, stream := range []string{"stdout", "stderr"} {
+		f, err := os.Create(outputPath(t, d.Name(), stream))
+		if err != nil {
+			return abort("", 0, err.Error())
+		}
+		defer f.Close()
+		streams[stream] = f
+	}
+	exit := TestResult{Status: "EXIT", File: t.Source, ExitCode: -1, Msg: "program did not exit"}
+
+	for {
+		ev, err := c.waitEvent("stopped", "output", "exited", "terminated")
+		if err != nil {
+			// The adapter is gone; leave the run truncated.
+			return err
+		}
+		switch ev.Event {
+		case "output":
+			var output struct {
+				Category string `json:"category"`
+				Output   string `json:"output"`
+			}
+			json.Unmarshal(ev.Body, &output)
+			if f := streams[output.Category]; f != nil {
+				f.WriteString(output.Output)
+			}
+			continue
+		case "exited":
+			var exited struct {
+				ExitCode int `json:"exitCode"`
+			}
+			json.Unmarshal(ev.Body, &exited)
+			exit.ExitCode, exit.Msg = exited.ExitCode, ""
+			continue
+		case "terminated":
+			c.request("disconnect", map[string]interface{}{}, nil)
+			if err := rc.send(exit); err != nil {
+				return err
+			}
+			return rc.end()
+		}
+		var stopped struct {
+			Reason           string `json:"reason"`
+			Description      string `json:"description"`
+			Text             string `json:"text"`
+			ThreadID         int    `json:"threadId"`
+			HitBreakpointIDs []int  `json:"hitBreakpointIds"`
+		}
+		json.Unmarshal(ev.Body, &stopped)
+		var trace struct {
+			StackFrames []dapFrame `json:"stackFrames"`
+		}
+		if err := c.request("stackTrace", map[string]interface{}{"threadId": stopped.ThreadID}, &trace); err != nil {
+			return abort("", 0, err.Error())
+		}
+		if len(trace.StackFrames) == 0 {
+			return abort("", 0, fmt.Sprintf("stopped (%s) with no stack", stopped.Reason))
+		}
+		top := trace.StackFrames[0]
+		switch reason := stopped.Reason; {
+		case crash != nil && isCrash(crash, reason, stopped.Description+" "+stopped.Text, top.Name):
+			// The program panicked or faulted. Test it
+			// once, then continue and let it die.
+			if err := d.runCrash(c, rc, *crash, trace.StackFrames); err != nil {
+				return err
+			}
+			if crash.Kind == "panic" {
+				if err := d.setPanicBreakpoint(c, false); err != nil {
+					return abort(crash.Filename, crash.Line, "failed to clear breakpoint on runtime.gopanic: "+err.Error())
+				}
+			}
+			crash = nil
+		case reason == "breakpoint" || reason == "function breakpoint":
+			bp, ok := set.hit(stopped.HitBreakpointIDs, top.Source.Path, top.Line)
+			if !ok {
+				return abort("", 0, fmt.Sprintf("stopped at an unrecognized breakpoint at %s %s:%d", top.Name, top.Source.Path, top.Line))
+			}
+			if err := d.runTests(c, rc, bp, top.ID, trace.StackFrames); err != nil {
+				return err
+			}
+		case reason == "entry":
+		default:
+			return abort("", 0, fmt.Sprintf("stopped unexpectedly (%s) at %s %s:%d", reason, top.Name, top.Source.Path, top.Line))
+		}
+		if err := c.request("continue", map[string]interface{}{"threadId": stopped.ThreadID}, nil); err != nil {
+			return abort("", 0, "failed to continue: "+err.Error())
+		}
+	}
+}
+
+// dapBreakpoints are the breakpoints set in an adapter, with the
+// BREAKPOINTs they were set for.
+type dapBreakpoints struct {
+	byID   map[int]*dapSetBreakpoint
+	byLine map[string]map[int]*dapSetBreakpoint // by file, then the line the adapter reported
+}
+
+type dapSetBreakpoint struct {
+	bp  Breakpoint
+	hit bool
+}
+
+func newDapBreakpoints() *dapBreakpoints {
+	return &dapBreakpoints{
+		byID:   make(map[int]*dapSetBreakpoint),
+		byLine: make(map[string]map[int]*dapSetBreakpoint),
+	}
+}
+
+// add notes b, the adapter's breakpoint in the file at path for bp.
+// Adapters that don't report where they put it are taken to have put
+// it on bp's line.
+func (s *dapBreakpoints) add(path string, b dapBreakpoint, bp Breakpoint) {
+	sb := &dapSetBreakpoint{bp: bp}
+	if b.ID != 0 {
+		s.byID[b.ID] = sb
+	}
+	line := b.Line
+	if line == 0 {
+		line = bp.Line
+	}
+	if s.byLine[path] == nil {
+		s.byLine[path] = make(map[int]*dapSetBreakpoint)
+	}
+	s.byLine[path][line] = sb
+}
+
+// hit returns the BREAKPOINT for a stop at a breakpoint, by the IDs of
+// the breakpoints hit, if the adapter reported them, or else by the
+// location of the stop. Each is returned only once.
+func (s *dapBreakpoints) hit(ids []int, path string, line int) (Breakpoint, bool) {
+	sb := s.byLine[path][line]
+	for _, id := range ids {
+		if b := s.byID[id]; b != nil && !b.hit {
+			sb = b
+			break
+		}
+	}
+	if sb == nil || sb.hit {
+		return Breakpoint{}, false
+	}
+	sb.hit = true
+	return sb.bp, true
+}
+
+// setPanicBreakpoint sets, or clears, the function breakpoint on
+// runtime.gopanic for a PANIC marker.
+func (d *Dap) setPanicBreakpoint(c *dapConn, set bool) error {
+	bps := []map[string]string{}
+	if set {
+		bps = append(bps, map[string]string{"name": "runtime.gopanic"})
+	}
+	var resp struct {
+		Breakpoints []struct {
+			Verified bool   `json:"verified"`
+			Message  string `json:"message"`
+		} `json:"breakpoints"`
+	}
+	if err := c.request("setFunctionBreakpoints", map[string]interface{}{"breakpoints": bps}, &resp); err != nil {
+		return err
+	}
+	if set && (len(resp.Breakpoints) == 0 || !resp.Breakpoints[0].Verified) {
+		msg := "not verified"
+		if len(resp.Breakpoints) > 0 && resp.Breakpoints[0].Message != "" {
+			msg += ": " + resp.Breakpoints[0].Message
+		}
+		return fmt.Errorf("%s", msg)
+	}
+	return nil
+}
+
+// isCrash reports whether a stop, for reason, with the given description,
+// in function fn, is the one expected by crash, a PANIC or SIGNAL marker.
+// Adapters report signals as exceptions, or as stops of their own reason.
+func isCrash(crash *Breakpoint, reason, description, fn string) bool {
+	switch crash.Kind {
+	case "panic":
+		return reason == "function breakpoint" || (reason == "breakpoint" && fn == "runtime.gopanic")
+	case "signal":
+		return (reason == "exception" || reason == "signal") && strings.Contains(description, crash.Signal)
+	}
+	return false
+}
+
+// runCrash runs the tests attached to bp, a PANIC or SIGNAL marker,
+// in the frame of stack that panicked or faulted.
+func (d *Dap) runCrash(c *dapConn, rc *reportConn, bp Breakpoint, stack []dapFrame) error {
+	for _, f := range stack {
+		if filepath.Base(f.Source.Path) == filepath.Base(bp.Filename) && f.Line == bp.StopLine {
+			return d.runTests(c, rc, bp, f.ID, stack)
+		}
+	}
+	msg := fmt.Sprintf("no frame at the %s marker", strings.ToUpper(bp.Kind))
+	return rc.send(TestResult{Status: "ERROR", File: bp.Filename, Line: bp.StopLine, Msg: msg})
+}
+
+// runTests runs the tests attached to bp, which has just been hit
+// in frame, the top of stack.
+func (d *Dap) runTests(c *dapConn, rc *reportConn, bp Breakpoint, frame int, stack []dapFrame) error {
+	for _, t := range bp.Tests {
+		if t.Debugger == "value" {
+			msg := "(value) tests are not supported by " + d.adapter()
+			if err := rc.send(TestResult{Status: "SKIP", File: bp.Filename, Line: t.Line, Msg: msg}); err != nil {
+				return err
+			}
+			continue
+		}
+		if !runs(d, t) {
+			continue
+		}
+		cmd, err := command(d, t)
+		if err != nil {
+			return err
+		}
+		// The output of commands run in the REPL is the
+		// debugger's own, as in its scripts.
+		style := "dap"
+		switch t.Debugger {
+		case "dap":
+			cmd = "evaluate " + cmd
+		case d.As:
+			cmd = "repl " + cmd
+			style = d.As
+		}
+		rc.send(TestResult{Status: "RUNNING", File: bp.Filename, Line: t.Line, Msg: cmd})
+		out, err := d.execute(c, cmd, frame, stack)
+		var res TestResult
+		if err != nil {
+			res = TestResult{Status: "FAIL", File: bp.Filename, Line: t.Line, Msg: "failed to execute command '" + cmd + "': " + err.Error()}
+		} else {
+			res = checkOutput(style, t, bp.Filename, out, d.normalize)
+		}
+		if err := rc.send(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute runs cmd, a translated command, in frame. Its output is in
+// the portable form; see portableVerbs.
+func (d *Dap) execute(c *dapConn, cmd string, frame int, stack []dapFrame) (string, error) {
+	verb, arg := dapVerb(cmd)
+	switch verb {
+	case "evaluate":
+		var resp struct {
+			Result string `json:"result"`
+		}
+		err := c.request("evaluate", map[string]interface{}{
+			"expression": arg,
+			"frameId":    frame,
+			"context":    "watch",
+		}, &resp)
+		return resp.Result, err
+	case "repl":
+		var resp struct {
+			Result string `json:"result"`
+		}
+		err := c.request("evaluate", map[string]interface{}{
+			"expression": d.ReplPrefix + arg,
+			"frameId":    frame,
+			"context":    "repl",
+		}, &resp)
+		return resp.Result, err
+	case "variables":
+		var scopes struct {
+			Scopes []struct {
+				Name               string `json:"name"`
+				PresentationHint   string `json:"presentationHint"`
+				VariablesReference int    `json:"variablesReference"`
+			} `json:"scopes"`
+		}
+		if err := c.request("scopes", map[string]interface{}{"frameId": frame}, &scopes); err != nil {
+			return "", err
+		}
+		var locals []string
+		for _, s := range scopes.Scopes {
+			if s.PresentationHint != "locals" && s.Name != "Locals" {
+				continue
+			}
+			var vars struct {
+				Variables []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"variables"`
+			}
+			if err := c.request("variables", map[string]interface{}{"variablesReference": s.VariablesReference}, &vars); err != nil {
+				return "", err
+			}
+			for _, v := range vars.Variables {
+				locals = append(locals, v.Name+" = "+v.Value)
+			}
+		}
+		sort.Strings(locals)
+		return strings.Join(locals, "\n"), nil
+	case "stackTrace":
+		var frames []string
+		for i, f := range stack {
+			frame := fmt.Sprintf("#%d %s", i, f.Name)
+			if f.Source.Path != "" {
+				frame += fmt.Sprintf(" at %s:%d", filepath.Base(f.Source.Path), f.Line)
+			}
+			frames = append(frames, frame)
+		}
+		return strings.Join(frames, "\n"), nil
+	}
+	return "", fmt.Errorf("unknown DAP command %q", verb)
+}
+
+func (d *Dap) Translate(verb, arg string) (string, error) {
+	return translate(dapPortable, verb, arg)
+}
+
+func (d *Dap) ScriptTemplate() *template.Template { return d.Template }
+
+// adapter returns the name of the adapter command, such as lldb-dap.
+func (d *Dap) adapter() string {
+	if len(d.Command) == 0 {
+		return "the adapter"
+	}
+	return filepath.Base(d.Command[0])
+}
+
+func (d *Dap) Name() string {
+	if d.As != "" {
+		return d.As
+	}
+	return "dap"
+}
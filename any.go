@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Portable (any) commands are translated into the equivalent command
+// for each Debugger, and their output is normalized to a common form:
+//
+//	print <expr>  the value alone, e.g. "5" or "{Field = 1, Name = "x"}"
+//	locals        one "name = value" line per local, sorted by name
+//	bt            one "#N function at file.go:line" line per frame
+//
+// The map records whether each verb takes an argument.
+var portableVerbs = map[string]bool{
+	"print":  true,
+	"locals": false,
+	"bt":     false,
+}
+
+// checkPortable checks that t, an (any) test, has a known verb
+// and the argument it takes, if any, so that each debugger can
+// translate it.
+func (t Test) checkPortable() error {
+	verb, arg := t.Portable()
+	takesArg, ok := portableVerbs[verb]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown (any) command %q", verb)
+	case takesArg && arg == "":
+		return fmt.Errorf("(any) %s requires an argument", verb)
+	case !takesArg && arg != "":
+		return fmt.Errorf("(any) %s takes no argument", verb)
+	}
+	return nil
+}
+
+// Portable splits t, an (any) test, into its verb and argument.
+func (t Test) Portable() (verb, arg string) {
+	verb = t.Command
+	if i := strings.IndexByte(verb, ' '); i >= 0 {
+		verb, arg = verb[:i], strings.TrimSpace(verb[i+1:])
+	}
+	return verb, arg
+}
+
+// translate renders the portable command verb, with argument arg,
+// using table, which maps verbs to fmt formats taking arg.
+func translate(table map[string]string, verb, arg string) (string, error) {
+	format, ok := table[verb]
+	if !ok {
+		return "", fmt.Errorf("no translation for (any) %s", verb)
+	}
+	if !strings.Contains(format, "%s") {
+		if arg != "" {
+			return "", fmt.Errorf("(any) %s takes no argument", verb)
+		}
+		return format, nil
+	}
+	if arg == "" {
+		return "", fmt.Errorf("(any) %s requires an argument", verb)
+	}
+	return fmt.Sprintf(format, arg), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// attachHelper is added to a copy of a test program with an ATTACH marker.
+// The marker becomes a call to debugoAttach, which tells debugo it is
+// ready by writing to fd 3, then spins, keeping the marker's frame on the
+// stack of a running thread until debugo kills it.
+const attachHelper = `package main
+
+import "os"
+
+var debugoAttached bool
+
+func debugoAttach() {
+	debugoAllowPtrace()
+	ready := os.NewFile(3, "ready")
+	ready.Write([]byte{1})
+	ready.Close()
+	for !debugoAttached {
+	}
+}
+`
+
+// attachPtraceHelpers define debugoAllowPtrace, by GOOS. Build constraints
+// don't apply to files named on the go build command line, so the right
+// one is chosen here.
+var attachPtraceHelpers = map[string]string{
+	"linux": `package main
+
+import "syscall"
+
+// debugoAllowPtrace lets any process attach, even with
+// the Yama LSM's ptrace_scope set to 1.
+func debugoAllowPtrace() {
+	const PR_SET_PTRACER, PR_SET_PTRACER_ANY = 0x59616d61, ^uintptr(0)
+	syscall.RawSyscall(syscall.SYS_PRCTL, PR_SET_PTRACER, PR_SET_PTRACER_ANY, 0)
+}
+`,
+	"": `package main
+
+func debugoAllowPtrace() {}
+`,
+}
+
+// attachTimeout is how long to wait for a program
+// to reach its ATTACH marker.
+const attachTimeout = 30 * time.Second
+
+// prepareAttach builds the attach variant of t, if it
+// has an ATTACH marker, setting t.AttachExecutable.
+func prepareAttach(goTool string, t *Target) error {
+	marker, err := findMarker(t, "attach")
+	if marker == nil || err != nil {
+		return err
+	}
+	ptrace, ok := attachPtraceHelpers[runtime.GOOS]
+	if !ok {
+		ptrace = attachPtraceHelpers[""]
+	}
+	helpers := map[string]string{
+		"debugo_attach.go":        attachHelper,
+		"debugo_attach_ptrace.go": ptrace,
+	}
+	executable, err := buildVariant(goTool, t, marker, "debugoAttach", helpers)
+	if err != nil {
+		return err
+	}
+	t.AttachExecutable = executable
+	return nil
+}
+
+// startAttach starts t.AttachExecutable and waits for it to reach
+// its ATTACH marker, setting t.AttachPid. Use stopAttach to kill it.
+func startAttach(t *Target) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dir := filepath.Dir(t.AttachExecutable)
+	output, err := os.Create(filepath.Join(dir, "output"))
+	if err != nil {
+		w.Close()
+		return err
+	}
+	defer output.Close()
+
+	cmd, stdin, err := programCommand(t.AttachExecutable, t)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	defer stdin.Close()
+	cmd.Dir = dir
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.ExtraFiles = []*os.File{w}
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = fmt.Errorf("%s exited without reaching its ATTACH marker", t.AttachExecutable)
+		}
+	case <-time.After(attachTimeout):
+		err = fmt.Errorf("%s did not reach its ATTACH marker within %v", t.AttachExecutable, attachTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	t.attachCmd = cmd
+	t.AttachPid = cmd.Process.Pid
+	return nil
+}
+
+// stopAttach kills the process started by startAttach, if any.
+func stopAttach(t *Target) {
+	if t.attachCmd == nil {
+		return
+	}
+	t.attachCmd.Process.Kill()
+	t.attachCmd.Wait()
+	t.attachCmd = nil
+	t.AttachPid = 0
+}
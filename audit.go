@@ -0,0 +1,149 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// An auditor collects, for -audit, the addresses that each debugger
+// resolves each BREAKPOINT line to, alongside the line's entries in the
+// DWARF line table, to report the lines that don't resolve to exactly one.
+type auditor struct {
+	lines    []auditLine
+	resolved map[diffKey]map[string][]string // addresses by line, then debugger
+}
+
+// An auditLine is a BREAKPOINT line and the line table entries for it:
+// those of the first line from there on that has any, which is where
+// debuggers move breakpoints on lines without code, such as comments.
+type auditLine struct {
+	key     diffKey
+	line    int      // line of the entries; 0 if there are none
+	entries int      // line table entries for line
+	stmts   []uint64 // distinct addresses of its statement entries
+	err     error    // reading the line table
+}
+
+func newAuditor() *auditor {
+	return &auditor{resolved: make(map[diffKey]map[string][]string)}
+}
+
+// add notes the BREAKPOINT lines of t, reading their entries from the
+// line table of t.Executable.
+func (a *auditor) add(t *Target) {
+	var lines map[int][]dwarf.LineEntry
+	d, err := openDWARF(t.Executable)
+	if err == nil {
+		lines, err = lineTable(d, t.Source)
+	}
+	last := 0
+	for line := range lines {
+		if line > last {
+			last = line
+		}
+	}
+	for _, bp := range t.Breakpoints {
+		if bp.Kind != "" {
+			continue
+		}
+		l := auditLine{key: diffKey{bp.Filename, bp.Line}, err: err}
+		for line := bp.Line; line <= last; line++ {
+			if entries := lines[line]; len(entries) > 0 {
+				l.line, l.entries, l.stmts = line, len(entries), stmts(entries)
+				break
+			}
+		}
+		a.lines = append(a.lines, l)
+	}
+}
+
+// record notes res, a LOCATIONS result from debugger.
+func (a *auditor) record(debugger string, res TestResult) {
+	key := diffKey{res.File, res.Line}
+	if a.resolved[key] == nil {
+		a.resolved[key] = make(map[string][]string)
+	}
+	a.resolved[key][debugger] = res.Addresses
+}
+
+// report prints a table of the lines, by debugger, marking those that
+// don't resolve to exactly one address, and returns how many there were.
+// A debugger that didn't report on a line, such as one that crashed,
+// is shown as "-" and doesn't count.
+func (a *auditor) report(w io.Writer) int {
+	debuggerSet := make(map[string]bool)
+	for _, r := range a.resolved {
+		for d := range r {
+			debuggerSet[d] = true
+		}
+	}
+	var debuggers []string
+	for d := range debuggerSet {
+		debuggers = append(debuggers, d)
+	}
+	sort.Strings(debuggers)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := append([]string{"[audit] LINE"}, debuggers...)
+	fmt.Fprintln(tw, strings.Join(append(header, "DWARF (line: is_stmt/entries)"), "\t"))
+	bad := 0
+	for _, l := range a.lines {
+		cols := []string{fmt.Sprintf("[audit] %s:%d", l.key.file, l.key.line)}
+		var notes []string
+		for _, d := range debuggers {
+			addrs, ok := a.resolved[l.key][d]
+			switch {
+			case !ok:
+				cols = append(cols, "-")
+				continue
+			case len(addrs) == 0:
+				notes = append(notes, "unresolvable in "+d)
+			case len(addrs) > 1:
+				notes = append(notes, fmt.Sprintf("%d addresses in %s: %s", len(addrs), d, strings.Join(addrs, " ")))
+			}
+			cols = append(cols, fmt.Sprint(len(addrs)))
+		}
+		table := fmt.Sprintf("%d: %d/%d", l.line, len(l.stmts), l.entries)
+		switch {
+		case l.err != nil:
+			table = "?"
+			notes = append(notes, "reading line table: "+l.err.Error())
+		case l.entries == 0:
+			table = "-"
+			notes = append(notes, "no line table entries")
+		case len(l.stmts) == 0:
+			notes = append(notes, "no is_stmt entries")
+		}
+		cols = append(cols, table)
+		if len(notes) > 0 {
+			bad++
+			cols = append(cols, strings.Join(notes, "; "))
+		}
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	tw.Flush()
+	return bad
+}
+
+// miBreakpointAddresses returns the addresses of the locations of the
+// breakpoint in r, the result of -break-insert. A breakpoint with several
+// locations has them listed in a locations list, as of MI3.
+func miBreakpointAddresses(r miRecord) []string {
+	bkpt, _ := r.Results["bkpt"].(map[string]interface{})
+	locs, ok := bkpt["locations"].([]interface{})
+	if !ok {
+		locs = []interface{}{bkpt}
+	}
+	var addrs []string
+	for _, l := range locs {
+		loc, _ := l.(map[string]interface{})
+		if addr, _ := loc["addr"].(string); strings.HasPrefix(addr, "0x") {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
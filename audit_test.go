@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMIBreakpointAddresses(t *testing.T) {
+	for _, tt := range []struct {
+		out  string
+		want []string
+	}{
+		{`^done,bkpt={number="1",type="breakpoint",disp="keep",enabled="y",addr="0x00000000004976d4",func="main.main",file="x.go",line="12",times="0"}`, []string{"0x00000000004976d4"}},
+		{`^done,bkpt={number="1",type="breakpoint",disp="keep",enabled="y",addr="<MULTIPLE>",times="0",locations=[{number="1.1",enabled="y",addr="0x00000000004976d4",func="main.main",file="x.go",line="12"},{number="1.2",enabled="y",addr="0x0000000000497810",func="main.f",file="x.go",line="12"}]}`, []string{"0x00000000004976d4", "0x0000000000497810"}},
+		{`^done,bkpt={number="1",type="breakpoint",disp="keep",enabled="y",addr="<PENDING>",pending="x.go:99",times="0"}`, nil},
+	} {
+		r, err := parseMI(tt.out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := miBreakpointAddresses(r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("miBreakpointAddresses(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestAuditorAdd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugo-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := "test/sanity.go"
+	bps, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &Target{Source: source, Executable: filepath.Join(dir, "sanity"), Breakpoints: bps}
+	if err := build("go", target.Executable, source); err != nil {
+		t.Fatal(err)
+	}
+	a := newAuditor()
+	a.add(target)
+	if len(a.lines) != len(bps) {
+		t.Fatalf("got %d lines, want %d", len(a.lines), len(bps))
+	}
+	for _, l := range a.lines {
+		if l.err != nil || l.line <= l.key.line || l.entries == 0 || len(l.stmts) == 0 {
+			t.Errorf("%s:%d: got %d entries for line %d, statements at %x, error %v", l.key.file, l.key.line, l.entries, l.line, l.stmts, l.err)
+		}
+	}
+}
+
+func TestAuditorReport(t *testing.T) {
+	a := newAuditor()
+	a.lines = []auditLine{
+		{key: diffKey{"x.go", 4}, line: 5, entries: 3, stmts: []uint64{0x10}},
+		{key: diffKey{"x.go", 8}, line: 8, entries: 2, stmts: []uint64{0x20, 0x30}},
+		{key: diffKey{"x.go", 12}},
+	}
+	a.record("gdb", TestResult{Status: "LOCATIONS", File: "x.go", Line: 4, Addresses: []string{"0x10"}})
+	a.record("lldb", TestResult{Status: "LOCATIONS", File: "x.go", Line: 4, Addresses: []string{"0x10"}})
+	a.record("gdb", TestResult{Status: "LOCATIONS", File: "x.go", Line: 8, Addresses: []string{"0x20", "0x30"}})
+	a.record("gdb", TestResult{Status: "LOCATIONS", File: "x.go", Line: 12})
+	a.record("lldb", TestResult{Status: "LOCATIONS", File: "x.go", Line: 12})
+
+	var buf bytes.Buffer
+	if n := a.report(&buf); n != 2 {
+		t.Errorf("report returned %d, want 2", n)
+	}
+	want := `[audit] LINE     gdb  lldb  DWARF (line: is_stmt/entries)
+[audit] x.go:4   1    1     5: 1/3
+[audit] x.go:8   2    -     8: 2/2  2 addresses in gdb: 0x20 0x30
+[audit] x.go:12  0    0     -       unresolvable in gdb; unresolvable in lldb; no line table entries
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if strings.Contains(buf.String(), " \n") {
+		t.Errorf("trailing spaces in report:\n%s", buf.String())
+	}
+}
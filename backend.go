@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// This file holds helpers shared by the script templates and
+// the debugger backends that are implemented in Go.
+
+// planTemplate is the "script" of the backends implemented in Go:
+// the test plan itself, which their Run methods read back with readPlan.
+const planTemplate = "{{json .}}\n"
+
+// readPlan reads the test plan written using planTemplate.
+func readPlan(scriptPath string) (ScriptContext, error) {
+	var dot ScriptContext
+	b, err := ioutil.ReadFile(scriptPath)
+	if err != nil {
+		return dot, err
+	}
+	err = json.Unmarshal(b, &dot)
+	return dot, err
+}
+
+// checkOutput checks out, the output of running t in a debugger whose
+// output looks like style's, against t.Want, as the scripts do. history
+// is ScriptContext.Normalize.
+func checkOutput(style string, t Test, filename, out string, history bool) TestResult {
+	res := TestResult{File: filename, Line: t.Line}
+	norm := t.Normalization()
+	if norm == "history" && !history {
+		norm = ""
+	}
+	out = normalizeOutput(style, norm, out)
+	want := strings.Join(t.Want, "\n")
+	re, err := regexp.Compile("^" + want + "$")
+	if err != nil {
+		res.Status = "ERROR"
+		res.Msg = "bad regex: " + err.Error()
+		return res
+	}
+	// Python's $ also matches before a trailing newline.
+	if re.MatchString(out) || re.MatchString(strings.TrimSuffix(out, "\n")) {
+		res.Status = "PASS"
+		res.Have = out
+		return res
+	}
+	res.Status = "FAIL"
+	res.Msg = "output did not match"
+	res.Want = t.Want
+	res.Have = out
+	return res
+}
+
+// command returns the command to run for t in d.
+func command(d Debugger, t Test) (string, error) {
+	if t.Debugger == "any" {
+		return d.Translate(t.Portable())
+	}
+	return t.Command, nil
+}
+
+// runs reports whether t should be run by d.
+func runs(d Debugger, t Test) bool {
+	return t.Debugger == d.Name() || t.Debugger == "any"
+}
+
+// shellArgs returns the arguments and stdin redirection for t's program,
+// quoted for a shell, as used by gdb's run command. It is "" or begins
+// with a space.
+func shellArgs(t *Target) string {
+	var b strings.Builder
+	for _, arg := range t.Args {
+		b.WriteString(" " + shellQuote(arg))
+	}
+	if t.Stdin != "" {
+		b.WriteString(" < " + shellQuote(t.Stdin))
+	}
+	return b.String()
+}
+
+var shellSafeRE = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	if shellSafeRE.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellSplit splits s into words as a POSIX shell does, after quote
+// removal but without expansions: words are separated by blanks, and
+// quoted with single quotes, double quotes or a backslash. Within double
+// quotes, a backslash only escapes a backslash, ", $ or `.
+func shellSplit(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated ' in %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+j])
+			i += 1 + j
+			inWord = true
+		case '"':
+			for i++; ; i++ {
+				if i == len(s) {
+					return nil, fmt.Errorf("unterminated \" in %q", s)
+				}
+				if s[i] == '"' {
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			inWord = true
+		case '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("trailing \\ in %q", s)
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// envName returns the name of the environment variable set by kv, KEY=value.
+func envName(kv string) string {
+	if i := strings.IndexByte(kv, '='); i >= 0 {
+		return kv[:i]
+	}
+	return kv
+}
+
+// programCommand returns a command that runs executable the way t's
+// program is run: with its arguments, environment and stdin. The caller
+// must close stdin, which is nil if t has no stdin file.
+func programCommand(executable string, t *Target) (cmd *exec.Cmd, stdin *os.File, err error) {
+	cmd = exec.Command(executable, t.Args...)
+	cmd.Env = append(os.Environ(), t.Env...)
+	if t.Stdin != "" {
+		stdin, err = os.Open(t.Stdin)
+		if err != nil {
+			return nil, nil, err
+		}
+		cmd.Stdin = stdin
+	}
+	return cmd, stdin, nil
+}
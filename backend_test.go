@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellArgs(t *testing.T) {
+	tests := []struct {
+		t    Target
+		want string
+	}{
+		{Target{}, ""},
+		{Target{Args: []string{"-n", "3"}}, " -n 3"},
+		{Target{Args: []string{"a b", "it's", ""}}, ` 'a b' 'it'\''s' ''`},
+		{Target{Stdin: "/tmp/in put"}, ` < '/tmp/in put'`},
+	}
+	for _, tt := range tests {
+		if have := shellArgs(&tt.t); have != tt.want {
+			t.Errorf("shellArgs(%q, %q) = %q, want %q", tt.t.Args, tt.t.Stdin, have, tt.want)
+		}
+	}
+}
+
+func TestShellSplit(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{" -n\t3 ", []string{"-n", "3"}},
+		{`'a b' "c \"d\" \x" e\ f`, []string{"a b", `c "d" \x`, "e f"}},
+		{`'' 'it'\''s'`, []string{"", "it's"}},
+		{`a'b'"c"`, []string{"abc"}},
+	}
+	for _, tt := range tests {
+		have, err := shellSplit(tt.s)
+		if err != nil || !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("shellSplit(%q) = %q, %v, want %q", tt.s, have, err, tt.want)
+		}
+	}
+	for _, s := range []string{"'a", `"a`, `a\`} {
+		if _, err := shellSplit(s); err == nil {
+			t.Errorf("shellSplit(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestCheckOutputNormalize(t *testing.T) {
+	test := Test{Debugger: "gdb", Command: "print i", Want: []string{`\$N = 5`}}
+	if res := checkOutput("gdb", test, "x.go", "$3 = 5\n", true); res.Status != "PASS" {
+		t.Errorf("checkOutput with normalization = %s %s, want PASS", res.Status, res.Msg)
+	}
+	if res := checkOutput("gdb", test, "x.go", "$3 = 5\n", false); res.Status != "FAIL" {
+		t.Errorf("checkOutput without normalization = %s, want FAIL", res.Status)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// bisect implements debugo bisect, which finds the first Go revision
+// at which a test file starts failing.
+func bisect(args []string) {
+	flags := flag.NewFlagSet("bisect", flag.ExitOnError)
+	goRepo := flags.String("go-repo", "", "`checkout` of Go in which good and bad are git revisions; without it, they are toolchain roots")
+	line := flags.Int("line", 0, "bisect on the test at `line` of the file; by default, any failure is bad")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s bisect [-go-repo dir] [-line n] test.go good bad\n\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 3 || !strings.HasSuffix(flags.Arg(0), ".go") {
+		flags.Usage()
+	}
+	source, goodRev, badRev := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+
+	if err := runBisect(source, goodRev, badRev, *goRepo, *line); err != nil {
+		fatal(err)
+	}
+}
+
+// runBisect does the work of bisect, cleaning up after itself before it
+// returns, which fatal wouldn't.
+func runBisect(source, goodRev, badRev, goRepo string, line int) error {
+	tempDir, err := ioutil.TempDir("", "debugo")
+	if err != nil {
+		return err
+	}
+	if *debug {
+		fmt.Println("Using temp dir", tempDir)
+	} else {
+		defer os.RemoveAll(tempDir)
+	}
+	b := &bisector{
+		source: source,
+		line:   line,
+		dir:    tempDir,
+		r:      &runner{tempDir: tempDir},
+	}
+	b.debuggers = initDebuggers()
+
+	if goRepo == "" {
+		// Toolchain roots: there is nothing in between,
+		// so just say how each does.
+		for _, root := range []string{goodRev, badRev} {
+			failed, err := b.test(filepath.Join(root, "bin", "go"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("[bisect] %s: %s\n", root, verdict(failed))
+		}
+		return nil
+	}
+
+	// Revisions: bisect the commits after good, up to and including bad.
+	out, err := git(goRepo, "rev-list", "--reverse", "--ancestry-path", goodRev+".."+badRev)
+	if err != nil {
+		return err
+	}
+	revs := strings.Fields(out)
+	if len(revs) == 0 {
+		return fmt.Errorf("%s is not a descendant of %s", badRev, goodRev)
+	}
+	goroot := filepath.Join(tempDir, "go")
+	if _, err := git(goRepo, "worktree", "add", "--detach", goroot, revs[0]); err != nil {
+		return err
+	}
+	defer git(goRepo, "worktree", "remove", "--force", goroot)
+
+	testRev := func(rev string) (failed bool, err error) {
+		fmt.Printf("[bisect] testing %s\n", rev)
+		goTool, err := makeGo(goroot, rev)
+		if err != nil {
+			return false, fmt.Errorf("building Go: %v", err)
+		}
+		return b.test(goTool)
+	}
+
+	// Check that good and bad are, as git bisect does.
+	for _, end := range []struct {
+		rev      string
+		wantFail bool
+	}{{goodRev, false}, {badRev, true}} {
+		failed, err := testRev(end.rev)
+		if err != nil {
+			return fmt.Errorf("%s: %v", end.rev, err)
+		}
+		fmt.Printf("[bisect] %s: %s\n", end.rev, verdict(failed))
+		if failed != end.wantFail {
+			return fmt.Errorf("%s is meant to be %s, but is %s", end.rev, verdict(end.wantFail), verdict(failed))
+		}
+	}
+
+	// Revisions at which Go or the test doesn't build are skipped,
+	// as by git bisect skip.
+	bad, skipped := firstBad(len(revs), func(i int) (bool, bool) {
+		failed, err := testRev(revs[i])
+		if err != nil {
+			fmt.Printf("[bisect] %s: skip: %v\n", revs[i], err)
+			return false, false
+		}
+		fmt.Printf("[bisect] %s: %s\n", revs[i], verdict(failed))
+		return failed, true
+	})
+	if len(skipped) > 0 {
+		fmt.Println("[bisect] the first bad revision could be any of these, which were skipped, or the one after:")
+		for _, i := range skipped {
+			summary, _ := git(goRepo, "log", "-1", "--oneline", revs[i])
+			fmt.Printf("[bisect]   %s", summary)
+		}
+	}
+	summary, _ := git(goRepo, "log", "-1", "--oneline", revs[bad])
+	fmt.Printf("[bisect] first bad revision: %s", summary)
+	return nil
+}
+
+// firstBad returns the first of n revisions that isBad, given that the
+// last is bad and the one before the first is good. It tests O(log n)
+// revisions. isBad reports false for ok if the revision can't be tested,
+// in which case its neighbors are tried instead; if that leaves the first
+// bad revision in doubt, the untestable revisions just before the one
+// returned are returned too.
+func firstBad(n int, isBad func(i int) (bad, ok bool)) (int, []int) {
+	lo, hi := -1, n-1 // lo is good, hi is bad
+	skip := make(map[int]bool)
+	for {
+		var untested []int
+		for i := lo + 1; i < hi; i++ {
+			if !skip[i] {
+				untested = append(untested, i)
+			}
+		}
+		if len(untested) == 0 {
+			break
+		}
+		mid := untested[len(untested)/2]
+		switch bad, ok := isBad(mid); {
+		case !ok:
+			skip[mid] = true
+		case bad:
+			hi = mid
+		default:
+			lo = mid
+		}
+	}
+	var skipped []int
+	for i := lo + 1; i < hi; i++ {
+		skipped = append(skipped, i)
+	}
+	return hi, skipped
+}
+
+// A bisector runs a test file with different Go toolchains.
+type bisector struct {
+	source    string
+	line      int // if non-zero, only failures at this line count
+	dir       string
+	debuggers []Debugger
+	r         *runner
+	tests     int // number of toolchains tested so far
+}
+
+// test builds and runs b.source using goTool, the go command of a toolchain
+// root, and reports whether it failed.
+func (b *bisector) test(goTool string) (failed bool, err error) {
+	toolchainRoots[goTool] = filepath.Dir(filepath.Dir(goTool))
+	goRoot, err := goRootOf(goTool)
+	if err != nil {
+		return false, err
+	}
+	if err := probeToolchain(b.debuggers, goTool, goRoot); err != nil {
+		return false, err
+	}
+	b.tests++
+	workDir := filepath.Join(b.dir, fmt.Sprintf("test%d", b.tests))
+	t, err := buildTarget(goTool, workDir, b.source)
+	if err != nil {
+		return false, err
+	}
+	if err := t.load(goTool); err != nil {
+		return false, err
+	}
+
+	b.r.goRoot = goRoot
+	b.r.observe = func(debugger string, res TestResult) {
+		if (res.Status == "FAIL" || res.Status == "ERROR") && (b.line == 0 || res.Line == b.line) {
+			failed = true
+		}
+	}
+	b.r.checkDWARF(t)
+	for _, d := range b.debuggers {
+		if err := b.r.run(d, []*Target{t}); err != nil {
+			return false, err
+		}
+	}
+	return failed, nil
+}
+
+func verdict(failed bool) string {
+	if failed {
+		return "bad"
+	}
+	return "good"
+}
+
+// makeGo checks out rev in goroot, a Go worktree, and builds it,
+// returning the path of its go command. GOROOT_BOOTSTRAP must be set
+// in the environment if there is no go command in the PATH.
+func makeGo(goroot, rev string) (string, error) {
+	if _, err := git(goroot, "checkout", "--quiet", "--detach", rev); err != nil {
+		return "", err
+	}
+	cmd := exec.Command("./make.bash")
+	cmd.Dir = filepath.Join(goroot, "src")
+	output := new(bytes.Buffer)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("make.bash failed:\n%s%v", output, err)
+	}
+	return filepath.Join(goroot, "bin", "go"), nil
+}
+
+// git runs git with args in dir, returning its output.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	output, errors := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout = output
+	cmd.Stderr = errors
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s:\n%s%v", strings.Join(cmd.Args, " "), errors, err)
+	}
+	return output.String(), nil
+}
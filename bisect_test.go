@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFirstBad(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		for want := 0; want < n; want++ {
+			tested := 0
+			have, skipped := firstBad(n, func(i int) (bool, bool) {
+				tested++
+				return i >= want, true
+			})
+			if have != want || skipped != nil {
+				t.Errorf("firstBad(%d) with first bad %d = %d, %v", n, want, have, skipped)
+			}
+			if tested > 4 {
+				t.Errorf("firstBad(%d) tested %d revisions", n, tested)
+			}
+		}
+	}
+}
+
+func TestFirstBadSkip(t *testing.T) {
+	tests := []struct {
+		n, want     int
+		skip        map[int]bool
+		wantSkipped []int
+	}{
+		// The skipped revision is good, and its neighbors settle it.
+		{9, 6, map[int]bool{4: true}, nil},
+		// The skipped revisions might be the first bad one.
+		{9, 5, map[int]bool{3: true, 4: true}, []int{3, 4}},
+		// Nothing can be tested.
+		{4, 3, map[int]bool{0: true, 1: true, 2: true}, []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		firstBadRev := tt.want - len(tt.wantSkipped)
+		have, skipped := firstBad(tt.n, func(i int) (bool, bool) {
+			return i >= firstBadRev, !tt.skip[i]
+		})
+		if have != tt.want || !reflect.DeepEqual(skipped, tt.wantSkipped) {
+			t.Errorf("firstBad(%d) skipping %v = %d, %v; want %d, %v", tt.n, tt.skip, have, skipped, tt.want, tt.wantSkipped)
+		}
+	}
+}
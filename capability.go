@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// knownCapabilities are the capabilities that //debugo:requires can
+// name. Each begins with the name of the debugger it is about.
+var knownCapabilities = map[string]string{
+	"gdb-python":      "gdb has Python scripting",
+	"gdb-runtime-gdb": "gdb can load the Go runtime's runtime-gdb.py",
+	"gdb-go":          "gdb can run a Go program to a breakpoint",
+}
+
+// A capable debugger reports what it can do, as probed by Init and,
+// for each Go toolchain tested, probeToolchain.
+type capable interface {
+	// Capable returns "" if the debugger has capability,
+	// or else why not.
+	Capable(capability string) string
+
+	// Needs returns the capabilities the debugger needs to run any
+	// program at all.
+	Needs() []string
+
+	// probeToolchain probes what the debugger can do with the Go
+	// toolchain of goTool, whose GOROOT is goRoot.
+	probeToolchain(goTool, goRoot string) error
+}
+
+// probeToolchain probes what each of debuggers can do with the Go
+// toolchain of goTool, whose GOROOT is goRoot.
+func probeToolchain(debuggers []Debugger, goTool, goRoot string) error {
+	for _, d := range debuggers {
+		if c, ok := d.(capable); ok {
+			if err := c.probeToolchain(goTool, goRoot); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// missing returns the capabilities among requires, and those d always
+// needs, that d lacks, each with the reason. Capabilities of other
+// debuggers are not d's concern.
+func missing(d Debugger, requires []string) []string {
+	var out []string
+	if c, ok := d.(capable); ok {
+		requires = append(c.Needs(), requires...)
+	}
+	seen := make(map[string]bool)
+	for _, req := range requires {
+		if seen[req] {
+			continue
+		}
+		seen[req] = true
+		if !strings.HasPrefix(req, d.Name()+"-") {
+			continue
+		}
+		why := "not probed"
+		if c, ok := d.(capable); ok {
+			why = c.Capable(req)
+		}
+		if why != "" {
+			out = append(out, req+" ("+why+")")
+		}
+	}
+	return out
+}
+
+// GdbCapabilities are what gdb was found to be able to do, by probeGdb
+// and, with the Go toolchain under test, probeToolchain.
+type GdbCapabilities struct {
+	Version    string // first line of gdb --version
+	Python     bool   // Python scripting is compiled in
+	RuntimeGdb bool   // $GOROOT/src/runtime/runtime-gdb.py loads
+	GoPrograms bool   // a trivial Go program runs to a breakpoint
+
+	path   string            // of gdb
+	goRoot string            // of the toolchain last probed
+	why    map[string]string // by capability, why it's missing
+}
+
+// Capable implements capable.
+func (c *GdbCapabilities) Capable(capability string) string {
+	if c == nil {
+		return "not probed"
+	}
+	var has bool
+	switch capability {
+	case "gdb-python":
+		has = c.Python
+	case "gdb-runtime-gdb":
+		has = c.RuntimeGdb
+	case "gdb-go":
+		has = c.GoPrograms
+	default:
+		return "unknown capability"
+	}
+	if has {
+		return ""
+	}
+	return c.why[capability]
+}
+
+func (c *GdbCapabilities) String() string {
+	var caps []string
+	for name := range knownCapabilities {
+		if strings.HasPrefix(name, "gdb-") && c.Capable(name) == "" {
+			caps = append(caps, name)
+		}
+	}
+	sort.Strings(caps)
+	return fmt.Sprintf("%s; capabilities: %s", c.Version, strings.Join(caps, " "))
+}
+
+var gdbBreakpointRE = regexp.MustCompile(`Breakpoint 1, main\.main `)
+
+// probeGdb probes what the gdb at path can do by itself. What it can do
+// with Go programs depends on the Go toolchain, and is probed by
+// probeToolchain.
+func probeGdb(path string) (*GdbCapabilities, error) {
+	c := &GdbCapabilities{path: path, why: make(map[string]string)}
+	version, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return nil, err
+	}
+	c.Version = strings.SplitN(string(version), "\n", 2)[0]
+
+	out, _ := gdbBatch(path, "", "python print('debugo' + '-python')")
+	c.Python = strings.Contains(out, "debugo-python")
+	if !c.Python {
+		c.why["gdb-python"] = "no Python scripting: " + lastLine(out)
+	}
+	c.why["gdb-runtime-gdb"] = "no Go toolchain probed"
+	c.why["gdb-go"] = "no Go toolchain probed"
+	return c, nil
+}
+
+// probeToolchain probes whether gdb can load the runtime-gdb.py of the
+// toolchain of goTool, whose GOROOT is goRoot, and debug a trivial
+// program built by it. It does nothing if that toolchain was the last
+// probed.
+func (c *GdbCapabilities) probeToolchain(goTool, goRoot string) error {
+	if c.goRoot == goRoot {
+		return nil
+	}
+	c.goRoot = goRoot
+	c.RuntimeGdb, c.GoPrograms = false, false
+
+	c.why["gdb-runtime-gdb"] = "needs Python"
+	if c.Python {
+		script := filepath.Join(goRoot, "src", "runtime", "runtime-gdb.py")
+		out, _ := gdbBatch(c.path, "", "source "+script)
+		c.RuntimeGdb = strings.Contains(out, "Loading Go Runtime support")
+		c.why["gdb-runtime-gdb"] = "loading " + script + ": " + lastLine(out)
+	}
+
+	dir, err := ioutil.TempDir("", "debugo-probe")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "probe.go")
+	executable := filepath.Join(dir, "probe")
+	if err := ioutil.WriteFile(source, []byte("package main\n\nfunc main() {\n\tprintln(\"probe\")\n}\n"), 0644); err != nil {
+		return err
+	}
+	if err := goBuild(goTool, executable, nil, []string{"-gcflags", "-N -l"}, source); err != nil {
+		c.why["gdb-go"] = err.Error()
+		return nil
+	}
+	out, _ := gdbBatch(c.path, executable, "break main.main", "run", "kill")
+	c.GoPrograms = gdbBreakpointRE.MatchString(out)
+	c.why["gdb-go"] = "running a Go program to a breakpoint: " + lastLine(out)
+	return nil
+}
+
+// gdbBatch runs the gdb at path in batch mode on executable, if any,
+// with commands, returning its combined output.
+func gdbBatch(path, executable string, commands ...string) (string, error) {
+	args := []string{"--batch", "--nx"}
+	for _, c := range commands {
+		args = append(args, "-ex", c)
+	}
+	if executable != "" {
+		args = append(args, executable)
+	}
+	cmd := exec.Command(path, args...)
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// lastLine returns the last non-blank line of out, which is usually
+// the most telling part of an error.
+func lastLine(out string) string {
+	lines := splitLines(strings.TrimSpace(out))
+	if len(lines) == 0 {
+		return "no output"
+	}
+	return lines[len(lines)-1]
+}
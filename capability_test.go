@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissing(t *testing.T) {
+	gdb := &GdbMI{Caps: &GdbCapabilities{
+		Python: true,
+		why:    map[string]string{"gdb-go": "ptrace: Operation not permitted."},
+	}}
+	requires := []string{"gdb-python", "gdb-go"}
+	if got, want := missing(gdb, requires), []string{"gdb-go (ptrace: Operation not permitted.)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missing(gdb) = %q, want %q", got, want)
+	}
+	if got := missing(new(Lldb), requires); len(got) != 0 {
+		t.Errorf("missing(lldb) = %q, want none", got)
+	}
+	if got, want := missing(new(Gdb), requires[:1]), []string{"gdb-python (not probed)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missing(unprobed gdb) = %q, want %q", got, want)
+	}
+
+	// The gdb script needs Python whatever the program requires.
+	noPython := &GdbCapabilities{why: map[string]string{"gdb-python": "no Python scripting"}}
+	want := []string{"gdb-python (no Python scripting)"}
+	if got := missing(&Gdb{Caps: noPython}, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("missing(gdb without Python) = %q, want %q", got, want)
+	}
+	if got := missing(&Gdb{Caps: noPython}, requires[:1]); !reflect.DeepEqual(got, want) {
+		t.Errorf("missing(gdb without Python, gdb-python) = %q, want %q", got, want)
+	}
+	if got := missing(&GdbMI{Caps: noPython}, nil); len(got) != 0 {
+		t.Errorf("missing(gdb mi without Python) = %q, want none", got)
+	}
+}
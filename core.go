@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// coreHelper is added to a copy of a test program with a CORE marker.
+// The marker becomes a call to debugoCore, which crashes the program
+// with a core dump, leaving the marker's frame on the stack.
+const coreHelper = `package main
+
+import (
+	"runtime/debug"
+	"syscall"
+)
+
+func debugoCore() {
+	var lim syscall.Rlimit
+	if syscall.Getrlimit(syscall.RLIMIT_CORE, &lim) == nil {
+		lim.Cur = lim.Max
+		syscall.Setrlimit(syscall.RLIMIT_CORE, &lim)
+	}
+	debug.SetTraceback("crash")
+	panic("debugo: CORE")
+}
+`
+
+// prepareCore builds and runs the core dumping variant of t, if it has
+// a CORE marker, setting t.CoreExecutable and t.Core.
+func prepareCore(goTool string, t *Target) error {
+	marker, err := findMarker(t, "core")
+	if marker == nil || err != nil {
+		return err
+	}
+	executable, err := buildVariant(goTool, t, marker, "debugoCore", map[string]string{"debugo_core.go": coreHelper})
+	if err != nil {
+		return err
+	}
+	core, err := dumpCore(executable, filepath.Dir(executable), t)
+	if err != nil {
+		return err
+	}
+	t.CoreExecutable = executable
+	t.Core = core
+	return nil
+}
+
+// dumpCore runs executable, as t's program, in dir
+// until it dumps core, and returns the path of the core file.
+func dumpCore(executable, dir string, t *Target) (string, error) {
+	var output bytes.Buffer
+	cmd, stdin, err := programCommand(executable, t)
+	if err != nil {
+		return "", err
+	}
+	defer stdin.Close()
+	cmd.Dir = dir
+	cmd.Env = append(cmd.Env, "GOTRACEBACK=crash")
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Run(); err == nil {
+		return "", fmt.Errorf("%s exited without reaching its CORE marker", executable)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "output"), output.Bytes(), 0644)
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && !ws.CoreDump() {
+		return "", fmt.Errorf("%s did not dump core (%s); is the core size limit 0?", executable, cmd.ProcessState)
+	}
+
+	pid := cmd.Process.Pid
+	candidates := []string{
+		filepath.Join(dir, "core"),
+		filepath.Join(dir, fmt.Sprintf("core.%d", pid)),
+		fmt.Sprintf("/cores/core.%d", pid), // darwin
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("no core file found for pid %d in %s; check where cores are written (on linux, /proc/sys/kernel/core_pattern)", pid, strings.Join(candidates, ", "))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// qemuArchs are qemu-user's names for the GOARCHes it can run,
+// as in qemu-aarch64.
+var qemuArchs = map[string]string{
+	"386":      "i386",
+	"amd64":    "x86_64",
+	"arm":      "arm",
+	"arm64":    "aarch64",
+	"loong64":  "loongarch64",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// crossEnv returns the additions to the environment of go build
+// that build test programs for -goarch, if it is set.
+func crossEnv() []string {
+	if *goarch == "" {
+		return nil
+	}
+	return []string{"GOOS=linux", "GOARCH=" + *goarch, "CGO_ENABLED=0"}
+}
+
+// gdbName returns the name of the gdb to use: gdb-multiarch for
+// -goarch, if there is one, since the distributions' gdb is often built
+// for the host architecture alone.
+func gdbName() string {
+	if *goarch != "" {
+		if _, err := exec.LookPath("gdb-multiarch"); err == nil {
+			return "gdb-multiarch"
+		}
+	}
+	return "gdb"
+}
+
+// qemuPath returns the path of the qemu-user emulator for -goarch.
+func qemuPath() (string, error) {
+	arch, ok := qemuArchs[*goarch]
+	if !ok {
+		return "", fmt.Errorf("no qemu-user emulator for GOARCH %s", *goarch)
+	}
+	return exec.LookPath("qemu-" + arch)
+}
+
+// qemuAttempts is how many ports startQemu tries before giving up.
+const qemuAttempts = 5
+
+// errQemuPort reports that qemu could not listen on the port it was given.
+var errQemuPort = errors.New("qemu exited before listening for a debugger")
+
+// startQemu starts t.Executable under qemu-user for -goarch, waiting for
+// a debugger to connect to its gdbstub, and sets t.Remote to the stub's
+// address. The program is run the way debugger runs it natively, with
+// its output going to debugger's stdout and stderr files. Use stopQemu
+// to kill it.
+func startQemu(t *Target, debugger string) error {
+	stopQemu(t)
+	qemu, err := qemuPath()
+	if err != nil {
+		return err
+	}
+	// The port is free when chosen but may be taken before qemu binds
+	// it, as by another run in parallel; try another one if so.
+	for i := 1; ; i++ {
+		err := tryQemu(t, debugger, qemu)
+		if err != errQemuPort || i == qemuAttempts {
+			return err
+		}
+	}
+}
+
+// tryQemu is one attempt of startQemu, on a port that is free now. It
+// waits for qemu to listen on the port, returning errQemuPort if qemu
+// exits first.
+func tryQemu(t *Target, debugger, qemu string) error {
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"-g", fmt.Sprint(port), t.Executable}, t.Args...)
+	cmd, stdin, err := programCommand(qemu, t)
+	if err != nil {
+		return err
+	}
+	defer stdin.Close()
+	cmd.Args = append(cmd.Args[:1], args...)
+	cmd.Dir = t.RunDir
+	stdout, err := os.Create(outputPath(t, debugger, "stdout"))
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(outputPath(t, debugger, "stderr"))
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	for deadline := time.Now().Add(10 * time.Second); !portInUse(port); {
+		select {
+		case <-exited:
+			if *debug {
+				fmt.Printf("qemu could not listen on port %d\n", port)
+			}
+			return errQemuPort
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			<-exited
+			return fmt.Errorf("qemu did not listen on port %d", port)
+		}
+	}
+	t.qemuCmd, t.qemuExited = cmd, exited
+	t.Remote = fmt.Sprintf("127.0.0.1:%d", port)
+	return nil
+}
+
+// freePort returns a TCP port on the loopback interface that is free now.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// portInUse reports whether something is listening on port, without
+// connecting to it: qemu's gdbstub takes only the one connection.
+func portInUse(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return true
+	}
+	l.Close()
+	return false
+}
+
+// stopQemu kills the emulator started by startQemu, if any.
+func stopQemu(t *Target) {
+	if t.qemuCmd == nil {
+		return
+	}
+	t.qemuCmd.Process.Kill()
+	<-t.qemuExited
+	t.qemuCmd, t.qemuExited = nil, nil
+	t.Remote = ""
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCrossEnv(t *testing.T) {
+	defer func(old string) { *goarch = old }(*goarch)
+
+	*goarch = ""
+	if env := crossEnv(); env != nil {
+		t.Errorf("crossEnv() without -goarch = %q, want nil", env)
+	}
+	if got := gdbName(); got != "gdb" {
+		t.Errorf("gdbName() without -goarch = %q, want gdb", got)
+	}
+
+	*goarch = "arm64"
+	if got, want := crossEnv(), []string{"GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("crossEnv() = %q, want %q", got, want)
+	}
+
+	*goarch = "wasm"
+	if _, err := qemuPath(); err == nil || !strings.Contains(err.Error(), "no qemu-user emulator") {
+		t.Errorf("qemuPath() for wasm: err = %v, want no qemu-user emulator", err)
+	}
+}
+
+func TestGdbScriptRemote(t *testing.T) {
+	g := new(Gdb)
+	g.Template = newScriptTemplate(g, gdbScriptTemplate)
+	target := &Target{Source: "x.go", RunDir: "/tmp/x", Executable: "/tmp/x/x", Remote: "127.0.0.1:1234"}
+	var b strings.Builder
+	if err := g.Template.Execute(&b, ScriptContext{Targets: []*Target{target}}); err != nil {
+		t.Fatal(err)
+	}
+	script := b.String()
+	if !strings.Contains(script, "\ntarget remote 127.0.0.1:1234\ncontinue\n") {
+		t.Errorf("script doesn't connect to the remote target:\n%s", script)
+	}
+	if strings.Contains(script, "\nrun") {
+		t.Errorf("script runs the program itself:\n%s", script)
+	}
+}
+
+// fakeQemu fails to bind the gdbstub's port on its first run, as when
+// the port was taken after startQemu chose it, and listens on it after.
+const fakeQemu = `#!/usr/bin/env python3
+import os, socket, sys, time
+tries = os.path.join(os.path.dirname(sys.argv[0]), "tries")
+with open(tries, "a") as f:
+    f.write("x")
+if os.path.getsize(tries) == 1:
+    sys.exit("qemu: could not open gdbserver on " + sys.argv[2])
+s = socket.socket()
+s.bind(("127.0.0.1", int(sys.argv[2])))
+s.listen(1)
+time.sleep(60)
+`
+
+func TestStartQemuRetries(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("no python3")
+	}
+	defer func(old string) { *goarch = old }(*goarch)
+	*goarch = "arm64"
+
+	dir, err := ioutil.TempDir("", "debugo-qemu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "qemu-aarch64"), []byte(fakeQemu), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+
+	target := &Target{RunDir: dir, Executable: filepath.Join(dir, "x")}
+	if err := startQemu(target, "gdb"); err != nil {
+		t.Fatalf("startQemu: %v", err)
+	}
+	defer stopQemu(target)
+	if tries, _ := ioutil.ReadFile(filepath.Join(dir, "tries")); len(tries) != 2 {
+		t.Errorf("qemu was run %d times, want 2", len(tries))
+	}
+	if !strings.HasPrefix(target.Remote, "127.0.0.1:") {
+		t.Errorf("Remote = %q, want a loopback address", target.Remote)
+	}
+}
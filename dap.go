@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// A dapMessage is a Debug Adapter Protocol message, as received.
+// See https://microsoft.github.io/debug-adapter-protocol/specification.
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"` // "request", "response" or "event"
+	Command    string          `json:"command,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// dapRequest is a request, as sent.
+type dapRequest struct {
+	Seq       int         `json:"seq"`
+	Type      string      `json:"type"`
+	Command   string      `json:"command"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// writeDAP writes v to w with DAP's Content-Length framing.
+func writeDAP(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	return err
+}
+
+// readDAP reads a single framed message from r.
+func readDAP(r *bufio.Reader) (dapMessage, error) {
+	var msg dapMessage
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return msg, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 || n > maxMessage {
+		return msg, fmt.Errorf("bad DAP Content-Length %q", header.Get("Content-Length"))
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return msg, fmt.Errorf("bad DAP message %q: %v", b, err)
+	}
+	return msg, nil
+}
+
+// A dapConn is a connection to a debug adapter.
+type dapConn struct {
+	w          io.Writer // the adapter's stdin, and the transcript
+	transcript io.Writer
+	r          *bufio.Reader
+	seq        int
+	events     []dapMessage // events that arrived while waiting for a response
+	early      []dapMessage // responses that arrived while waiting for another
+}
+
+// start sends a request, returning its sequence number
+// for use with response.
+func (c *dapConn) start(command string, args interface{}) (int, error) {
+	c.seq++
+	return c.seq, writeDAP(c.w, dapRequest{Seq: c.seq, Type: "request", Command: command, Arguments: args})
+}
+
+// response waits for the response to request seq,
+// and decodes its body into body, if non-nil.
+func (c *dapConn) response(seq int, body interface{}) error {
+	var resp dapMessage
+	found := false
+	for i, m := range c.early {
+		if m.RequestSeq == seq {
+			resp, found = m, true
+			c.early = append(c.early[:i], c.early[i+1:]...)
+			break
+		}
+	}
+	for !found {
+		m, err := readDAP(c.r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case m.Type == "event":
+			c.events = append(c.events, m)
+		case m.Type == "response" && m.RequestSeq == seq:
+			resp, found = m, true
+		case m.Type == "response":
+			c.early = append(c.early, m)
+		}
+		// Reverse requests, such as runInTerminal, are not
+		// advertised in our capabilities, and are ignored.
+	}
+	if !resp.Success {
+		msg := resp.Message
+		var errBody struct {
+			Error struct {
+				Format string `json:"format"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(resp.Body, &errBody) == nil && errBody.Error.Format != "" {
+			msg = errBody.Error.Format
+		}
+		if msg == "" {
+			msg = "request failed"
+		}
+		return fmt.Errorf("%s: %s", resp.Command, msg)
+	}
+	if body != nil && len(resp.Body) > 0 {
+		return json.Unmarshal(resp.Body, body)
+	}
+	return nil
+}
+
+// request sends a request and waits for its response.
+func (c *dapConn) request(command string, args, body interface{}) error {
+	seq, err := c.start(command, args)
+	if err != nil {
+		return err
+	}
+	return c.response(seq, body)
+}
+
+// waitEvent waits for one of the named events.
+// Any other events are discarded.
+func (c *dapConn) waitEvent(names ...string) (dapMessage, error) {
+	want := func(m dapMessage) bool {
+		for _, name := range names {
+			if m.Event == name {
+				return true
+			}
+		}
+		return false
+	}
+	for len(c.events) > 0 {
+		m := c.events[0]
+		c.events = c.events[1:]
+		if want(m) {
+			return m, nil
+		}
+	}
+	for {
+		m, err := readDAP(c.r)
+		if err != nil {
+			return m, err
+		}
+		if m.Type == "response" {
+			c.early = append(c.early, m)
+			continue
+		}
+		if m.Type == "event" && want(m) {
+			return m, nil
+		}
+	}
+}
+
+// dapVerb splits a translated DAP command into its request and argument.
+func dapVerb(cmd string) (verb, arg string) {
+	verb = cmd
+	if i := strings.IndexByte(cmd, ' '); i >= 0 {
+		verb, arg = cmd[:i], strings.TrimSpace(cmd[i+1:])
+	}
+	return verb, arg
+}
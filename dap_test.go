@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDAPFraming(t *testing.T) {
+	var buf bytes.Buffer
+	req := dapRequest{Seq: 1, Type: "request", Command: "evaluate", Arguments: map[string]string{"expression": "x + \"é\""}}
+	if err := writeDAP(&buf, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDAP(&buf, req); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(&buf)
+	for i := 0; i < 2; i++ {
+		msg, err := readDAP(r)
+		if err != nil {
+			t.Fatalf("readDAP: %v", err)
+		}
+		if msg.Seq != 1 || msg.Type != "request" || msg.Command != "evaluate" {
+			t.Errorf("readDAP = %+v", msg)
+		}
+	}
+	if _, err := readDAP(r); err != io.ErrUnexpectedEOF {
+		t.Errorf("readDAP at EOF: %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	for _, in := range []string{
+		"Content-Length: x\r\n\r\n{}",
+		"Content-Length: 10\r\n\r\n{}",
+		"Content-Length: 2\r\n\r\n{]",
+	} {
+		if _, err := readDAP(bufio.NewReader(strings.NewReader(in))); err == nil {
+			t.Errorf("readDAP(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestDAPConn(t *testing.T) {
+	var out bytes.Buffer
+	for _, m := range []string{
+		`{"seq":1,"type":"event","event":"initialized"}`,
+		`{"seq":2,"type":"response","request_seq":2,"command":"configurationDone","success":true}`,
+		`{"seq":3,"type":"response","request_seq":1,"command":"launch","success":true}`,
+		`{"seq":4,"type":"event","event":"output","body":{"output":"hi"}}`,
+		`{"seq":5,"type":"event","event":"stopped","body":{"reason":"breakpoint","threadId":7}}`,
+		`{"seq":6,"type":"response","request_seq":3,"command":"evaluate","success":false,"body":{"error":{"format":"no such variable"}}}`,
+		`{"seq":7,"type":"response","request_seq":4,"command":"evaluate","success":true,"body":{"result":"5"}}`,
+	} {
+		writeDAP(&out, json.RawMessage(m))
+	}
+	var in bytes.Buffer
+	c := &dapConn{w: &in, r: bufio.NewReader(&out)}
+
+	launch, err := c.start("launch", map[string]string{"program": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.request("configurationDone", nil, nil); err != nil {
+		t.Fatalf("configurationDone: %v", err)
+	}
+	if ev, err := c.waitEvent("initialized"); err != nil || ev.Seq != 1 {
+		t.Fatalf("waitEvent(initialized) = %+v, %v", ev, err)
+	}
+	if err := c.response(launch, nil); err != nil {
+		t.Fatalf("launch: %v", err)
+	}
+	ev, err := c.waitEvent("stopped")
+	if err != nil || ev.Seq != 5 {
+		t.Fatalf("waitEvent(stopped) = %+v, %v", ev, err)
+	}
+	var resp struct {
+		Result string `json:"result"`
+	}
+	if err := c.request("evaluate", nil, &resp); err == nil || err.Error() != "evaluate: no such variable" {
+		t.Errorf("evaluate error = %v", err)
+	}
+	if err := c.request("evaluate", nil, &resp); err != nil || resp.Result != "5" {
+		t.Errorf("evaluate = %q, %v", resp.Result, err)
+	}
+}
+
+func TestDAPRepl(t *testing.T) {
+	var out bytes.Buffer
+	writeDAP(&out, json.RawMessage(`{"seq":1,"type":"response","request_seq":1,"command":"evaluate","success":true,"body":{"result":"(int) x = 5\n"}}`))
+	var in bytes.Buffer
+	c := &dapConn{w: &in, r: bufio.NewReader(&out)}
+	d := &Dap{As: "lldb", ReplPrefix: "`"}
+	if d.Name() != "lldb" {
+		t.Errorf("Name = %q, want lldb", d.Name())
+	}
+
+	have, err := d.execute(c, "repl frame variable x", 3, nil)
+	if err != nil || have != "(int) x = 5\n" {
+		t.Errorf("execute = %q, %v", have, err)
+	}
+	var req struct {
+		Command   string `json:"command"`
+		Arguments struct {
+			Expression string `json:"expression"`
+			FrameID    int    `json:"frameId"`
+			Context    string `json:"context"`
+		} `json:"arguments"`
+	}
+	sent := in.String()
+	if err := json.Unmarshal([]byte(sent[strings.Index(sent, "\r\n\r\n")+4:]), &req); err != nil {
+		t.Fatal(err)
+	}
+	args := req.Arguments
+	if req.Command != "evaluate" || args.Expression != "`frame variable x" || args.FrameID != 3 || args.Context != "repl" {
+		t.Errorf("sent %s %+v, want evaluate of `frame variable x in the REPL of frame 3", req.Command, args)
+	}
+}
+
+// fakeAdapter plays a debug adapter on r and w for TestDAPRunTarget.
+// It puts the breakpoint on line, the line after the BREAKPOINT comment,
+// as adapters do, and reports the hit with the breakpoint's ID if ids.
+func fakeAdapter(r io.Reader, w io.Writer, path string, line int, ids bool) {
+	br := bufio.NewReader(r)
+	send := func(m string) { writeDAP(w, json.RawMessage(m)) }
+	respond := func(req dapMessage, body string) {
+		send(fmt.Sprintf(`{"type":"response","request_seq":%d,"command":%q,"success":true,"body":%s}`, req.Seq, req.Command, body))
+	}
+	for {
+		req, err := readDAP(br)
+		if err != nil {
+			return
+		}
+		switch req.Command {
+		case "launch":
+			send(`{"type":"event","event":"initialized"}`)
+			respond(req, `{}`)
+		case "setBreakpoints":
+			respond(req, fmt.Sprintf(`{"breakpoints":[{"id":7,"verified":true,"line":%d}]}`, line))
+		case "configurationDone":
+			respond(req, `{}`)
+			hit := ""
+			if ids {
+				hit = `,"hitBreakpointIds":[7]`
+			}
+			send(`{"type":"event","event":"stopped","body":{"reason":"breakpoint","threadId":1` + hit + `}}`)
+		case "stackTrace":
+			respond(req, fmt.Sprintf(`{"stackFrames":[{"id":1000,"name":"main.main","line":%d,"source":{"path":%q}}]}`, line, path))
+		case "evaluate":
+			respond(req, `{"result":"5"}`)
+		case "continue":
+			respond(req, `{}`)
+			send(`{"type":"event","event":"output","body":{"category":"stdout","output":"x"}}`)
+			send(`{"type":"event","event":"exited","body":{"exitCode":0}}`)
+			send(`{"type":"event","event":"terminated"}`)
+		case "disconnect":
+			respond(req, `{}`)
+			return
+		default:
+			respond(req, `{}`)
+		}
+	}
+}
+
+func TestDAPRunTarget(t *testing.T) {
+	for _, ids := range []bool{true, false} {
+		dir := t.TempDir()
+		source := filepath.Join(dir, "x.go")
+		target := &Target{
+			Source:     source,
+			RunDir:     dir,
+			Executable: filepath.Join(dir, "x"),
+			RunID:      "1",
+			Sock:       filepath.Join(dir, "run.sock"),
+			Breakpoints: []Breakpoint{{
+				Filename: source,
+				Line:     5,
+				Tests: []Test{
+					{Line: 6, Debugger: "dap", Command: "i", Want: []string{"5"}},
+					{Line: 7, Debugger: "value", Command: "i == 5"},
+				},
+			}, {
+				Filename: source,
+				Line:     10,
+				Kind:     "core",
+				Tests:    []Test{{Line: 11, Debugger: "dap", Command: "i", Want: []string{"5"}}},
+			}},
+		}
+		l, err := net.Listen("unix", target.Sock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resc := make(chan TestResult, 10)
+		done := make(chan error, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				done <- err
+				return
+			}
+			defer conn.Close()
+			_, err = readRun(conn, "1", "dap", resc)
+			close(resc)
+			done <- err
+		}()
+
+		// Buffered, as a real adapter's stdin and stdout are.
+		toAdapter, adapterIn, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		adapterOut, fromAdapter, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go fakeAdapter(toAdapter, fromAdapter, source, 7, ids)
+		d := &Dap{Command: []string{"fake"}}
+		c := &dapConn{w: adapterIn, r: bufio.NewReader(adapterOut)}
+		if err := d.runTarget(c, target); err != nil {
+			t.Fatalf("ids=%v: runTarget: %v", ids, err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("ids=%v: readRun: %v", ids, err)
+		}
+		l.Close()
+		adapterIn.Close()
+		adapterOut.Close()
+
+		var statuses []string
+		for res := range resc {
+			statuses = append(statuses, res.Status)
+			if res.Status == "ERROR" || res.Status == "FAIL" {
+				t.Errorf("ids=%v: %+v", ids, res)
+			}
+		}
+		if got, want := strings.Join(statuses, " "), "SKIP RUNNING PASS SKIP EXIT"; got != want {
+			t.Errorf("ids=%v: results %s, want %s", ids, got, want)
+		}
+	}
+}
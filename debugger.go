@@ -1,13 +1,45 @@
 package main
 
-import "text/template"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
 
 // Debugger is the interface shared between Gdb and Lldb.
 type Debugger interface {
 	Init() error // if non-nil return, do not use
 	Name() string
 	ScriptTemplate() *template.Template
-	Run(executable string, scriptPath string) error
+	Run(executable string, scriptPath string, stdout, stderr io.Writer) error
+	Translate(verb, arg string) (string, error) // translate a portable (any) command
 }
 
-// TODO: DRY up some of lldb, gdb: python boilerplate, funcMap
+// TODO: DRY up python boilerplate between lldb and gdb
+
+// newScriptTemplate parses a script template for d.
+func newScriptTemplate(d Debugger, text string) *template.Template {
+	funcMap := template.FuncMap{
+		"joinn": func(v interface{}) (string, error) {
+			slice, ok := v.([]string)
+			if !ok {
+				return "", fmt.Errorf("expected []string, got %v (%T)", v, v)
+			}
+			return strings.Join(slice, "\n"), nil
+		},
+		"command": func(t Test) (string, error) { return command(d, t) },
+		"runs":    func(t Test) bool { return runs(d, t) },
+		"upper":   strings.ToUpper,
+		"args":    shellArgs,
+		"envName": envName,
+		"sh":      shellQuote,
+		"output":  func(t *Target, stream string) string { return outputPath(t, d.Name(), stream) },
+		"json": func(v interface{}) (string, error) {
+			b, err := json.MarshalIndent(v, "", "\t")
+			return string(b), err
+		},
+	}
+	return template.Must(template.New("script").Funcs(funcMap).Parse(text))
+}
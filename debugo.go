@@ -2,23 +2,16 @@ package main
 
 // TODO:
 // * Improve naming, docs, tests
-// * Better socket handling? Kind crude and in-place right now.
 // * Better output formatting, more output formatting options (summary?).
 // * Check to make sure that all breakpoints got hit; fail if not.
-// * Invoke gdb/lldb only once, load/unload targets in turn?
-//   Should be faster, but complicated scripts, and takes longer
-//   to get to first failure.
 // * Run multiple tests in parallel? Should be ok in theory, but
 //   muddles output.
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -30,6 +23,19 @@ var (
 	debug   = flag.Bool("d", false, "print lots of debug goop")
 	noGdb   = flag.Bool("no-gdb", false, "skip gdb")
 	noLldb  = flag.Bool("no-lldb", false, "skip lldb")
+
+	session     = flag.Bool("session", false, "run all tests in a single session of each debugger, one debugger after another, restarting it if it crashes")
+	artifacts   = flag.String("artifacts", "", "keep built executables, scripts and debugger transcripts in `dir`")
+	showOutput  = flag.Bool("show-output", false, "on failure, print the debugger transcript around the failing command")
+	dapAdapter  = flag.String("dap", "", "also test the debug adapter run by `command`, such as lldb-dap, which must speak DAP on stdio")
+	gdbBackend  = flag.String("gdb-backend", "script", "how to drive gdb: script (a generated gdb script) or mi (GDB/MI, from Go)")
+	lldbBackend = flag.String("lldb-backend", "script", "how to drive lldb: script (a generated Python script) or dap (lldb-dap, from Go, needing no Python)")
+	goarch      = flag.String("goarch", "", "cross-build the tests for `arch`, such as arm64, and run them under qemu-user, debugged remotely by gdb-multiarch")
+	pythonFlag  = flag.String("python", "", "Python `interpreter` for the lldb script; by default, the first that can import lldb's module of lldb's own, python3 and python")
+	normalize   = flag.Bool("normalize", true, "rewrite value history prefixes ($1, (int) $0) of print commands to $N before matching")
+	diffMode    = flag.Bool("diff", false, "instead of checking expectations, report where the debuggers' renderings of (any) print and locals and (value) tests differ")
+	auditMode   = flag.Bool("audit", false, "instead of running the tests, report how many addresses each debugger resolves each BREAKPOINT line to, and the line's DWARF line table entries")
+	liveMode    = flag.Bool("liveness", false, "instead of running the tests, compare the locals at each BREAKPOINT in -N -l and optimized builds, and score each function by how many are still available")
 )
 
 const usageFooter = `
@@ -40,19 +46,31 @@ debugo runs automated tests of Go's gdb and lldb integration.
 // generate a debugger test script from a template.
 // TODO: Better name.
 type ScriptContext struct {
-	GoRoot      string
-	Sock        string // socket path for sending replies to
-	Breakpoints []Breakpoint
-	Executable  string
+	GoRoot   string
+	Protocol int       // result protocol version
+	Targets  []*Target // run in order by a single debugger process
+	Audit    bool      // for -audit, resolve the BREAKPOINT lines instead of running the tests
+
+	// Normalize is -normalize: whether to rewrite the value history
+	// prefixes of the tests that Test.Normalize.
+	Normalize bool
 }
 
 // TestResult represents something that happened while running a test.
 // TODO: Better naming
 type TestResult struct {
-	Status string `json:"status"` // "RUNNING", "PASS", "FAIL", "ERROR", "INFO"
-	File   string `json:"file"`
-	Line   int    `json:"line"`
-	Msg    string `json:"msg"`
+	Status   string   `json:"status"` // "RUNNING", "PASS", "FAIL", "ERROR", "INFO", "VALUE", "EXIT", "LOCATIONS", "SKIP"
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Msg      string   `json:"msg"`
+	Value    *Value   `json:"value,omitempty"`     // for "VALUE" results, which are checked by debugo
+	ExitCode int      `json:"exit_code,omitempty"` // for "EXIT" results, which are checked by debugo
+	Want     []string `json:"want,omitempty"`      // for "FAIL" results, the regexes that failed to match
+	Have     string   `json:"have,omitempty"`      // for "PASS" and "FAIL" results, the command output
+
+	// For "LOCATIONS" results, sent by -audit, the addresses the
+	// breakpoint at the line resolved to, if any.
+	Addresses []string `json:"addresses,omitempty"`
 }
 
 func (tr TestResult) String() string {
@@ -61,7 +79,9 @@ func (tr TestResult) String() string {
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "usage: %s [args] <test-cases>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "usage: %s [args] <test-cases>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s gen [-o dir] [kind ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s bisect [-go-repo dir] [-line n] test.go good bad\n\n", os.Args[0])
 		flag.PrintDefaults()
 		fmt.Fprint(os.Stderr, usageFooter)
 		os.Exit(2)
@@ -70,39 +90,43 @@ func main() {
 	if flag.NArg() < 1 {
 		flag.Usage()
 	}
+	switch flag.Arg(0) {
+	case "gen":
+		gen(flag.Args()[1:])
+		return
+	case "bisect":
+		bisect(flag.Args()[1:])
+		return
+	}
 
 	// Make sure all our tools are available
 	goTool, err := exec.LookPath("go")
 	if err != nil {
 		fatal(err)
 	}
-	cmd := exec.Command(goTool, "env", "GOROOT")
-	goRootBuf := new(bytes.Buffer)
-	cmd.Stdout = goRootBuf
-	if err := cmd.Run(); err != nil {
+	goRoot, err := goRootOf(goTool)
+	if err != nil {
 		fatal(err)
 	}
-	goRoot := strings.TrimSpace(goRootBuf.String())
 
-	debuggers := make([]Debugger, 0, 2)
-	if !*noGdb {
-		gdb := new(Gdb)
-		if err := gdb.Init(); err != nil {
-			fmt.Printf("SKIPPING gdb: %v\n", err)
-		} else {
-			debuggers = append(debuggers, gdb)
-		}
+	debuggers := initDebuggers()
+	if err := probeToolchain(debuggers, goTool, goRoot); err != nil {
+		fatal(err)
 	}
-	if !*noLldb {
-		lldb := new(Lldb)
-		if err := lldb.Init(); err != nil {
-			fmt.Printf("SKIPPING lldb: %v\n", err)
-		} else {
-			debuggers = append(debuggers, lldb)
+	if *diffMode && len(debuggers) < 2 {
+		fatal("-diff needs at least two debuggers.")
+	}
+	modes := 0
+	for _, mode := range []bool{*diffMode, *auditMode, *liveMode} {
+		if mode {
+			modes++
 		}
 	}
-	if len(debuggers) == 0 {
-		fatal("No debuggers available.")
+	if modes > 1 {
+		fatal("-diff, -audit and -liveness are exclusive.")
+	}
+	if *liveMode && len(debuggers) == 0 {
+		fatal("-liveness needs a debugger.")
 	}
 
 	// Set up temp dir
@@ -122,94 +146,313 @@ func main() {
 		}()
 	}
 
-	// Set up socket for receiving replies
-	sock := filepath.Join(tempDir, "status.sock")
-	listener, err := net.Listen("unix", sock)
-	if err != nil {
-		fatal(err)
+	// Artifacts (executables, scripts, transcripts) go in the temp dir
+	// unless we've been asked to keep them.
+	workDir := tempDir
+	if *artifacts != "" {
+		workDir = *artifacts
 	}
-	defer listener.Close()
 
+	var targets []*Target
 	for _, source := range flag.Args() {
 		if !strings.HasSuffix(source, ".go") {
 			fmt.Printf("SKIPPING test %s: Does not have .go suffix\n", source)
 			continue
 		}
 
-		if *debug {
-			fmt.Printf("Running test %s\n", source)
-		}
-
-		// Build executable
-		executable := filepath.Join(tempDir, source[:len(source)-len(".go")])
-		cmd := exec.Command(goTool, "build", "-o", executable, "-gcflags", "-N -l", source)
-		buildErr := new(bytes.Buffer)
-		cmd.Stderr = buildErr
-		if *debug {
-			fmt.Println("Running", cmd)
-		}
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Failed to build %s:\n", source)
-			fmt.Println(buildErr.String())
+		t, err := buildTarget(goTool, workDir, source)
+		if err != nil {
 			fatal(err)
 		}
-
-		// Parse the code to extract test cases
-		bps, err := Parse(source)
-		if err != nil {
+		if err := t.load(goTool); err != nil {
 			fmt.Printf("SKIPPING test %s: Failed to parse: %v\n", source, err)
 			continue
 		}
+		targets = append(targets, t)
+	}
 
-		// Test with all debuggers
-		for _, d := range debuggers {
-
-			// Listen for replies and parse them
-			replyc := make(chan TestResult)
-			go func() {
-				conn, err := listener.Accept()
-				if err != nil {
-					fatal(err)
-				}
-				scan := bufio.NewScanner(conn)
-				for scan.Scan() {
-					line := scan.Bytes()
-					var res TestResult
-					err := json.Unmarshal(line, &res)
-					if err != nil {
-						fmt.Println("Failed to unmarshal JSON:", string(line))
-						fatal(err)
-					}
-					replyc <- res
-				}
-				if err := scan.Err(); err != nil {
-					fatal(err)
-				}
-			}()
-
-			go func() {
-				// TODO: Count to make sure we ran the expected number of tests
-				// TODO: better print of info/error messages w/ no file/lineno
-				for reply := range replyc {
-					if reply.Status == "FAIL" || *verbose {
-						fmt.Printf("[%s] %v\n", d.Name(), reply)
-					}
-				}
-			}()
+	// DWARF checks and audits need no debugger.
+	if len(debuggers) == 0 && !*auditMode {
+		dwarfChecks := false
+		for _, t := range targets {
+			dwarfChecks = dwarfChecks || len(t.DWARF) > 0
+		}
+		if !dwarfChecks {
+			fatal("No debuggers available.")
+		}
+		fmt.Println("No debuggers available; running DWARF checks only.")
+	}
 
-			// Run debugger
-			scriptPath := filepath.Join(tempDir, "script."+d.Name())
-			dot := ScriptContext{GoRoot: goRoot, Sock: sock, Breakpoints: bps, Executable: executable}
-			if err := writeScript(d, scriptPath, dot); err != nil {
+	// Test with all debuggers
+	r := &runner{goRoot: goRoot, tempDir: tempDir}
+	if *diffMode {
+		r.diff = newDiffer()
+		for _, t := range targets {
+			r.diff.add(t)
+		}
+	}
+	if *auditMode {
+		r.audit = newAuditor()
+		for _, t := range targets {
+			r.audit.add(t)
+		}
+	}
+	if *liveMode {
+		// Each target is run again, optimized.
+		r.liveness = newLiveness()
+		for _, t := range targets {
+			if err := r.liveness.add(t); err != nil {
 				fatal(err)
 			}
-			if err := d.Run(executable, scriptPath); err != nil {
+			opt, err := buildOptimized(goTool, t)
+			if err != nil {
 				fatal(err)
 			}
+			targets = append(targets, opt)
+		}
+	}
+	if *session {
+		for _, t := range targets {
+			r.checkDWARF(t)
+		}
+		for _, d := range debuggers {
+			if err := r.run(d, targets); err != nil {
+				fatal(err)
+			}
+		}
+	} else {
+		for _, t := range targets {
+			r.checkDWARF(t)
+			for _, d := range debuggers {
+				if err := r.run(d, []*Target{t}); err != nil {
+					fatal(err)
+				}
+			}
+		}
+	}
+	if r.diff != nil {
+		n := r.diff.report(os.Stdout)
+		fmt.Printf("[diff] %d disagreements\n", n)
+	}
+	if r.audit != nil {
+		n := r.audit.report(os.Stdout)
+		fmt.Printf("[audit] %d lines not resolving to exactly one address\n", n)
+	}
+	if r.liveness != nil {
+		r.liveness.report(os.Stdout, *verbose)
+	}
+}
+
+// goRootOf returns the GOROOT of goTool, a go command.
+func goRootOf(goTool string) (string, error) {
+	cmd := exec.Command(goTool, "env", "GOROOT")
+	cmd.Env = goEnv(goTool)
+	goRootBuf := new(bytes.Buffer)
+	cmd.Stdout = goRootBuf
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(goRootBuf.String()), nil
+}
+
+// initDebuggers returns the debuggers chosen by the flags that are
+// available.
+func initDebuggers() []Debugger {
+	debuggers := make([]Debugger, 0, 2)
+	if *goarch != "" {
+		// Only gdb can debug the programs remotely, under qemu-user.
+		if _, err := qemuPath(); err != nil {
+			fatal(err)
+		}
+		if !*noLldb {
+			fmt.Println("SKIPPING lldb: not supported with -goarch")
+		}
+		if *dapAdapter != "" {
+			fmt.Println("SKIPPING dap: not supported with -goarch")
+		}
+		*noLldb = true
+		*dapAdapter = ""
+	}
+	if !*noGdb {
+		var gdb Debugger
+		switch *gdbBackend {
+		case "script":
+			gdb = new(Gdb)
+		case "mi":
+			gdb = new(GdbMI)
+		default:
+			fatal("unknown -gdb-backend " + *gdbBackend)
+		}
+		if err := gdb.Init(); err != nil {
+			fmt.Printf("SKIPPING gdb: %v\n", err)
+		} else {
+			debuggers = append(debuggers, gdb)
+		}
+	}
+	if !*noLldb {
+		var lldb Debugger
+		switch *lldbBackend {
+		case "script":
+			lldb = new(Lldb)
+		case "dap":
+			lldb = newLldbDap()
+		default:
+			fatal("unknown -lldb-backend " + *lldbBackend)
+		}
+		if err := lldb.Init(); err != nil {
+			fmt.Printf("SKIPPING lldb: %v\n", err)
+		} else {
+			debuggers = append(debuggers, lldb)
+		}
+	}
+	if *dapAdapter != "" {
+		dap := &Dap{Command: strings.Fields(*dapAdapter)}
+		if err := dap.Init(); err != nil {
+			fmt.Printf("SKIPPING dap: %v\n", err)
+		} else {
+			debuggers = append(debuggers, dap)
+		}
+	}
+	return debuggers
+}
+
+// buildTarget builds source using goTool, in its own directory under workDir.
+// Use t.load to fill in its tests.
+func buildTarget(goTool, workDir, source string) (*Target, error) {
+	if *debug {
+		fmt.Printf("Building test %s\n", source)
+	}
+	runDir := filepath.Join(workDir, runDirName(source))
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return nil, err
+	}
+	executable := filepath.Join(runDir, filepath.Base(runDir))
+	if err := build(goTool, executable, source); err != nil {
+		return nil, err
+	}
+	return &Target{Source: source, RunDir: runDir, Executable: executable}, nil
+}
+
+// runDirName returns the name of source's directory under the work dir:
+// its path without .go, with the elements that would lead out of the work
+// dir, the root of an absolute path and .., renamed _ and __.
+func runDirName(source string) string {
+	name := filepath.ToSlash(strings.TrimSuffix(filepath.Clean(source), ".go"))
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		switch elem {
+		case "":
+			elems[i] = "_"
+		case "..":
+			elems[i] = "__"
+		}
+	}
+	return filepath.Join(elems...)
+}
+
+// load parses t's source to extract its tests, and builds the variants
+// for its CORE and ATTACH markers, reporting any errors doing so.
+// It returns an error only if the source fails to parse.
+func (t *Target) load(goTool string) error {
+	file, err := ParseFile(t.Source)
+	if err != nil {
+		return err
+	}
+
+	if *diffMode {
+		file.Breakpoints = diffTests(file.Breakpoints)
+		file.Expect = Expect{}
+		file.DWARF = nil
+	}
+	if *liveMode {
+		file.Breakpoints = livenessTests(file.Breakpoints)
+		file.Expect = Expect{}
+		file.DWARF = nil
+	}
+
+	// Index the (value) tests, which are checked here rather than in the scripts
+	valueTests := make(map[int]Test)
+	for _, bp := range file.Breakpoints {
+		for _, t := range bp.Tests {
+			if t.Debugger == "value" {
+				valueTests[t.Line] = t
+			}
+		}
+	}
 
-			close(replyc)
+	t.Breakpoints = file.Breakpoints
+	t.Args = file.Args
+	t.Env = file.Env
+	t.Stdin = file.Stdin
+	t.Requires = file.Requires
+	t.Expect = file.Expect
+	t.DWARF = file.DWARF
+	t.valueTests = valueTests
+
+	// Audits and liveness reports only use BREAKPOINTs.
+	if *auditMode || *liveMode {
+		t.DWARF = nil
+		return nil
+	}
+
+	// The variants run natively, so they can't be cross-built.
+	if *goarch != "" {
+		for _, bp := range t.Breakpoints {
+			if bp.Kind == "core" || bp.Kind == "attach" {
+				fmt.Printf("SKIPPING %s markers in %s: not supported with -goarch\n", strings.ToUpper(bp.Kind), t.Source)
+			}
 		}
+		return nil
+	}
+
+	if err := prepareCore(goTool, t); err != nil {
+		rep := newReporter(os.Stdout, "core")
+		rep.report(TestResult{Status: "ERROR", File: t.Source, Msg: err.Error()})
+		rep.done()
+	}
+	if err := prepareAttach(goTool, t); err != nil {
+		rep := newReporter(os.Stdout, "attach")
+		rep.report(TestResult{Status: "ERROR", File: t.Source, Msg: err.Error()})
+		rep.done()
+	}
+	return nil
+}
+
+// build builds sources into executable, with optimizations
+// and inlining disabled.
+func build(goTool, executable string, sources ...string) error {
+	return goBuild(goTool, executable, crossEnv(), []string{"-gcflags", "-N -l"}, sources...)
+}
+
+// goBuild builds sources into executable, with the build flags flags
+// and env added to the environment.
+func goBuild(goTool, executable string, env, flags []string, sources ...string) error {
+	args := append([]string{"build", "-o", executable}, flags...)
+	args = append(args, sources...)
+	cmd := exec.Command(goTool, args...)
+	cmd.Env = goEnv(goTool, env...)
+	buildErr := new(bytes.Buffer)
+	cmd.Stderr = buildErr
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to build %s:\n%s%v", strings.Join(sources, " "), buildErr, err)
+	}
+	return nil
+}
+
+// toolchainRoots maps the go commands of the toolchains bisect tests to
+// their roots. They are run with that GOROOT, whatever the caller's is.
+var toolchainRoots = make(map[string]string)
+
+// goEnv returns the environment to run goTool in, with env added.
+func goEnv(goTool string, env ...string) []string {
+	env = append(os.Environ(), env...)
+	if root, ok := toolchainRoots[goTool]; ok {
+		env = append(env, "GOROOT="+root)
 	}
+	return env
 }
 
 func fatal(e interface{}) {
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestRunDirName(t *testing.T) {
+	tests := []struct{ source, want string }{
+		{"test/x.go", "test/x"},
+		{"./test/../x.go", "x"},
+		{"../other/x.go", "__/other/x"},
+		{"../../x.go", "__/__/x"},
+		{"/tmp/x.go", "_/tmp/x"},
+	}
+	for _, tt := range tests {
+		if got := runDirName(tt.source); got != tt.want {
+			t.Errorf("runDirName(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// anyOutput is the Want of the tests run by -diff, which
+// matches any output, so that it is all reported back.
+const anyOutput = `[\s\S]*`
+
+// diffTests returns the tests run by -diff at bps: their portable
+// print and locals commands and (value) tests, with wants that match
+// anything, plus locals at every breakpoint.
+func diffTests(bps []Breakpoint) []Breakpoint {
+	var out []Breakpoint
+	for _, bp := range bps {
+		var tests []Test
+		locals := false
+		for _, t := range bp.Tests {
+			switch verb, _ := t.Portable(); {
+			case t.Debugger == "value":
+				tests = append(tests, t)
+			case t.Debugger == "any" && (verb == "print" || verb == "locals"):
+				locals = locals || verb == "locals"
+				tests = append(tests, Test{Line: t.Line, Debugger: "any", Command: t.Command, Want: []string{anyOutput}})
+			}
+		}
+		if !locals {
+			tests = append(tests, Test{Line: bp.Line, Debugger: "any", Command: "locals", Want: []string{anyOutput}})
+		}
+		bp.Tests = tests
+		out = append(out, bp)
+	}
+	return out
+}
+
+// A differ collects the renderings of the -diff tests
+// by each debugger, to report where they disagree.
+type differ struct {
+	commands   map[diffKey]string            // each test, as written, such as "(any) locals"
+	renderings map[diffKey]map[string]string // by test, then debugger
+}
+
+type diffKey struct {
+	file string
+	line int
+}
+
+func newDiffer() *differ {
+	return &differ{
+		commands:   make(map[diffKey]string),
+		renderings: make(map[diffKey]map[string]string),
+	}
+}
+
+// add notes the tests to be run for t.
+func (df *differ) add(t *Target) {
+	for _, bp := range t.Breakpoints {
+		for _, test := range bp.Tests {
+			df.commands[diffKey{bp.Filename, test.Line}] = "(" + test.Debugger + ") " + test.Command
+		}
+	}
+}
+
+// record notes the rendering in res, a PASS, FAIL, VALUE or SKIP
+// result from debugger. Values are rendered without their type names,
+// which the debuggers spell differently.
+func (df *differ) record(debugger string, res TestResult) {
+	key := diffKey{res.File, res.Line}
+	var rendering string
+	switch {
+	case res.Status == "VALUE" && res.Value != nil:
+		rendering = res.Value.untypedString()
+	case res.Status == "PASS":
+		rendering = res.Have
+	default:
+		rendering = "(" + strings.ToLower(res.Status) + ") " + res.Msg
+	}
+	if df.renderings[key] == nil {
+		df.renderings[key] = make(map[string]string)
+	}
+	df.renderings[key][debugger] = rendering
+}
+
+// report prints the tests whose renderings differ between debuggers,
+// and returns how many there were. A debugger that didn't run a test,
+// such as one that crashed, doesn't count as disagreeing.
+func (df *differ) report(w io.Writer) int {
+	var keys []diffKey
+	for key, r := range df.renderings {
+		distinct := make(map[string]bool)
+		for _, rendering := range r {
+			distinct[rendering] = true
+		}
+		if len(distinct) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].file != keys[j].file {
+			return keys[i].file < keys[j].file
+		}
+		return keys[i].line < keys[j].line
+	})
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "[diff] %s:%d DIFF %s\n", key.file, key.line, df.commands[key])
+		var debuggers []string
+		for d := range df.renderings[key] {
+			debuggers = append(debuggers, d)
+		}
+		sort.Strings(debuggers)
+		for _, d := range debuggers {
+			lines := splitLines(df.renderings[key][d])
+			if len(lines) == 0 {
+				lines = []string{""}
+			}
+			for i, line := range lines {
+				prefix := strings.Repeat(" ", len(d)+1)
+				if i == 0 {
+					prefix = d + ":"
+				}
+				fmt.Fprintf(w, "    %s %s\n", prefix, line)
+			}
+		}
+	}
+	return len(keys)
+}
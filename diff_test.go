@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiffTests(t *testing.T) {
+	bps := []Breakpoint{
+		{Filename: "x.go", Line: 4, Tests: []Test{
+			{Line: 5, Debugger: "gdb", Command: "info locals", Want: []string{"x = 1"}},
+			{Line: 7, Debugger: "any", Command: "print x", Want: []string{"1"}},
+			{Line: 9, Debugger: "any", Command: "bt", Want: []string{".*"}},
+			{Line: 11, Debugger: "value", Command: "x", Want: []string{"1"}},
+		}},
+		{Filename: "x.go", Line: 20, Tests: []Test{
+			{Line: 21, Debugger: "any", Command: "locals", Want: []string{"x = 1"}},
+		}},
+	}
+	want := []Breakpoint{
+		{Filename: "x.go", Line: 4, Tests: []Test{
+			{Line: 7, Debugger: "any", Command: "print x", Want: []string{anyOutput}},
+			{Line: 11, Debugger: "value", Command: "x", Want: []string{"1"}},
+			{Line: 4, Debugger: "any", Command: "locals", Want: []string{anyOutput}},
+		}},
+		{Filename: "x.go", Line: 20, Tests: []Test{
+			{Line: 21, Debugger: "any", Command: "locals", Want: []string{anyOutput}},
+		}},
+	}
+	if have := diffTests(bps); !reflect.DeepEqual(have, want) {
+		t.Errorf("diffTests = %+v, want %+v", have, want)
+	}
+}
+
+func TestDiffer(t *testing.T) {
+	df := newDiffer()
+	df.add(&Target{Breakpoints: []Breakpoint{
+		{Filename: "x.go", Line: 4, Tests: []Test{
+			{Line: 5, Debugger: "any", Command: "print x"},
+			{Line: 6, Debugger: "value", Command: "s"},
+			{Line: 4, Debugger: "any", Command: "locals"},
+			{Line: 7, Debugger: "value", Command: "t"},
+		}},
+	}})
+	df.record("gdb", TestResult{Status: "PASS", File: "x.go", Line: 5, Have: "1"})
+	df.record("lldb", TestResult{Status: "PASS", File: "x.go", Line: 5, Have: "1"})
+	df.record("gdb", TestResult{Status: "VALUE", File: "x.go", Line: 6, Value: &Value{Kind: "string", Value: "a"}})
+	df.record("lldb", TestResult{Status: "FAIL", File: "x.go", Line: 6, Msg: "failed to evaluate 's'"})
+	// The same value, with type names spelled differently, agrees.
+	df.record("gdb", TestResult{Status: "VALUE", File: "x.go", Line: 7, Value: &Value{Kind: "struct", Type: "main.T", Children: []Child{
+		{Name: "S", Value: &Value{Kind: "list", Type: "[]int", Children: []Child{{Value: &Value{Kind: "scalar", Value: "1"}}}}},
+	}}})
+	df.record("lldb", TestResult{Status: "VALUE", File: "x.go", Line: 7, Value: &Value{Kind: "struct", Type: "T", Children: []Child{
+		{Name: "S", Value: &Value{Kind: "list", Type: "[]int", Children: []Child{{Value: &Value{Kind: "scalar", Value: "1"}}}}},
+	}}})
+	df.record("gdb", TestResult{Status: "PASS", File: "x.go", Line: 4, Have: "s = \"a\"\nx = 1"})
+	df.record("lldb", TestResult{Status: "PASS", File: "x.go", Line: 4, Have: "x = 1"})
+
+	var buf bytes.Buffer
+	if n := df.report(&buf); n != 2 {
+		t.Errorf("report found %d disagreements, want 2", n)
+	}
+	want := `[diff] x.go:4 DIFF (any) locals
+    gdb: s = "a"
+         x = 1
+    lldb: x = 1
+[diff] x.go:6 DIFF (value) s
+    gdb: "a"
+    lldb: (fail) failed to evaluate 's'
+`
+	if buf.String() != want {
+		t.Errorf("report printed:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -13,12 +13,12 @@
 // 	b := false
 // 	// BREAKPOINT
 // 	// (gdb) print i
-// 	// \$1 = 5
+// 	// \$N = 5
 // 	// (gdb) info locals
 // 	// b = false
 // 	// i = 5
 // 	// (lldb) print i
-// 	// \(int\) \$0 = 5
+// 	// \(int\) \$N = 5
 // 	return i, b
 // }
 //
@@ -30,12 +30,171 @@
 // debugger they are to be run with. Commands for different debuggers
 // can be intermingled freely.
 //
+// Commands prefaced with "(dap)" are expressions, evaluated through a debug
+// adapter's evaluate request, as an IDE's watch window would. They are run
+// only with -dap, which names the adapter command, e.g. -dap lldb-dap.
+//
 // The expected output is interpreted as a Python regular expression, thus the
 // escaping of the dollar signs and parens in the example above.
 //
+// The output of print commands (print, p, call, and lldb's expression) has
+// its value history prefix rewritten before matching: gdb's "$1 = " and
+// lldb's "(int) $0 = " become "$N = " and "(int) $N = ", respectively.
+// This keeps expectations stable when tests are added or removed earlier
+// in the file. Use -normalize=false to match the raw output instead.
+//
+// Commands prefaced with "(any)" are portable: they are translated into
+// the equivalent command for each debugger, and the output is normalized
+// to a common form, so that a single expectation covers all debuggers.
+// The portable commands are:
+//
+// 	print <expr>  the value alone, e.g. 5 or {Field = 1, Name = "x"}
+// 	locals        one "name = value" line per local, sorted by name
+// 	bt            one "#N function at file.go:line" line per frame
+//
+// Values can also be checked semantically, independent of how any
+// particular debugger prints them:
+//
+// 	// (value) s == []int{1, 2, 3}
+// 	// (value) m["k"].Field == 7
+//
+// The left hand side is a variable followed by any number of field
+// selectors, indexes and dereferences. The right hand side is a Go
+// constant, nil, or composite literal; type names in composite literals
+// are ignored, and may be elided in elements as in Go. nil matches only
+// nil slices and maps, not empty ones. Each debugger evaluates the
+// variable and sends back its value as a JSON tree, which debugo compares
+// against the literal. The lldb script walks maps itself, as lldb has no
+// Go formatters, and reports (value) tests of the swiss table maps of
+// Go 1.24 and later as SKIP.
+//
+// Core files are tested with a "// CORE" marker in place of "// BREAKPOINT".
+// debugo builds a copy of the program in which the marker calls a helper
+// that panics with GOTRACEBACK=crash, runs it to get a core dump, and has
+// each debugger load the core, select the frame at the marker, and run the
+// marker's tests. A program may have only one CORE marker. The system must
+// allow core dumps to be written to the working directory (on linux, see
+// /proc/sys/kernel/core_pattern).
+//
+// Attaching to a running process is tested with a "// ATTACH" marker.
+// Similarly, the marker calls a helper that signals debugo over a pipe and
+// then spins. debugo starts the program, waits for the signal, and has each
+// debugger attach to the process, select the frame at the marker, and run
+// the marker's tests. debugo kills the process afterwards.
+//
+// Crashes are tested with a "// PANIC" or "// SIGNAL SIGSEGV" marker,
+// placed immediately before the statement that panics or faults. The
+// program runs as usual, with a breakpoint on runtime.gopanic or a
+// catchpoint for the signal. When the debugger stops there, it selects
+// the frame at that statement, runs the marker's tests, and lets the
+// program carry on dying. A program may have only one PANIC or SIGNAL
+// marker. Panics from nil dereferences start as SIGSEGV, which the
+// debuggers stop for first, so test those with SIGNAL.
+//
+// File-level directives set how the program is run, under every debugger:
+//
+// 	//debugo:args -flag value   program arguments; may be repeated
+// 	//debugo:env KEY=value      added to the environment; may be repeated
+// 	//debugo:stdin in.txt       stdin, relative to the source file
+// 	//debugo:requires gdb-go    capabilities a debugger needs to run the program
+//
+// The arguments are split as by a shell, so an argument with spaces can
+// be quoted, as in //debugo:args -name 'a b'; nothing is expanded.
+//
+// When it starts, debugo probes what gdb can do: whether it has Python
+// scripting (gdb-python), can load the Go runtime's runtime-gdb.py
+// (gdb-runtime-gdb), and can run a trivial Go program to a breakpoint
+// (gdb-go). A debugger lacking a capability the program requires skips
+// it, saying why; the other debuggers still run it. The gdb script needs
+// Python, so without it gdb skips every program, as if each required
+// gdb-python; -gdb-backend mi doesn't. The last two are probed with the Go
+// toolchain under test, which for bisect is each one tested. -v prints
+// gdb's version and capabilities.
+//
+// How the program finishes is checked with EXPECT comments, anywhere in
+// the file:
+//
+// 	// EXPECT-EXIT 0            the exit status
+// 	// EXPECT-STDOUT hello .*   a line of stdout, as a regexp; may be repeated
+// 	// EXPECT-STDERR panic: .*  likewise, for stderr
+//
+// Each debugger reports an EXIT result when the program exits. The lines
+// of EXPECT-STDOUT, joined with newlines, must match the whole of stdout,
+// and likewise for EXPECT-STDERR. Exiting by a signal fails EXPECT-EXIT.
+// The program's output is kept in stdout.<debugger> and stderr.<debugger>
+// in the run directory. The debugger's own exit status doesn't depend on
+// the program's.
+//
+// The debug info itself is checked with DWARF comments, which are read
+// from the executable by debugo, with no debugger involved:
+//
+// 	// DWARF var i type=int location=present
+// 	// DWARF line 12 is_stmt
+//
+// A var check looks up the variable in the function containing the comment,
+// or its closures; type is the DWARF type name and location is present or
+// absent. A line check requires line table entries for the line, and with
+// is_stmt, one that is a statement. The results are reported by "dwarf",
+// so DWARF checks still run on machines without gdb or lldb.
+//
 // The test parser ignores /* */ comments. If you need to add commentary into the
 // middle of a test, you can do so by using /* */.
 //
+// With -diff, debugo checks no expectations. Instead, every debugger
+// runs the (any) print and locals commands and (value) tests at each
+// breakpoint, plus (any) locals at every breakpoint, and debugo reports
+// the commands whose normalized output differs between debuggers. This
+// needs at least two debuggers, such as gdb and lldb, or -dap.
+//
+// With -audit, debugo runs no tests. Instead, each debugger resolves
+// every BREAKPOINT line by setting a breakpoint there, as the tests do,
+// without running the program, and debugo prints a table of
+// how many addresses each resolved the line to, next to the line table's
+// is_stmt and total entries for it. Lines that don't resolve to exactly
+// one address, which the lldb script otherwise fails on, are marked.
+//
+// With -liveness, debugo also runs no tests. Instead, it builds each test
+// program twice, with -N -l and with the compiler's defaults, and every
+// debugger runs (any) locals at each BREAKPOINT in both. Each local shown
+// in the -N -l build is classified by how the optimized build shows it:
+// available, with the same value up to addresses; optimized out, if it
+// is missing or the debugger says so; or wrong. debugo prints, for each
+// function and debugger, the counts and a debuggability score, the
+// percentage available, to track across Go releases. Breakpoints not
+// reached in the optimized build, say because of inlining or because
+// their line has no code left, are counted separately. A line with
+// several locations in the optimized build is tested at the first reached. With -v, each local that isn't available is listed.
+//
+// With -goarch, such as -goarch arm64, debugo cross-builds the test
+// programs for linux on that architecture and runs each under qemu-user,
+// as qemu-aarch64 -g PORT, which waits for gdb to connect with target
+// remote. The tests then run as usual, against the remote program, all
+// on one host. Only gdb is supported, preferably gdb-multiarch, and CORE
+// and ATTACH markers are skipped.
+//
+// To find the Go change that broke a test, run
+//
+// 	debugo bisect -go-repo ~/go [-line n] test.go good bad
+//
+// where good and bad are git revisions of the Go checkout ~/go. debugo
+// builds Go at each revision it tests in a worktree (GOROOT_BOOTSTRAP
+// may be needed), rebuilds and runs the test file in the debuggers, and
+// reports the first revision at which it fails. It first checks that the
+// test passes at good and fails at bad, and stops if not; with -line, only
+// failures of the test at that line count. Revisions at which Go or the
+// test doesn't build are skipped, as by git bisect skip. Without -go-repo, good and bad
+// are the roots of two Go toolchains, and debugo reports which fail.
+//
+// Test programs covering each kind of value, from numbers and strings to
+// channels and instances of generic types, are generated by
+//
+// 	debugo gen -o test/gen [kind ...]
+//
+// Each declares representative values before a BREAKPOINT, with (value)
+// tests whose expectations are computed from the declarations by type
+// checking the program. Values with no Go literal, such as non-nil
+// channels and funcs, get an (any) print test instead.
+//
 //
 // How it works, at a high level:
 //
@@ -45,10 +204,36 @@
 // 3. Parse the source file, extracting breakpoints and associated tests.
 // 4. Generate a script to be fed to gdb/lldb. The gdb script is a sequence of
 //    gdb commands, dropping down to Python as needed. The lldb script is a
-//    Python script, which uses the Python lldb module to drive lldb.
-// 5. Listen on a socket to receive test results. (This proved to be much easier
-//    and more robust than trying to directly parse the output from gdb or lldb.)
-// 6. Execute the test script, gathering results.
-// 7. Repeat as needed.
+//    Python script, which uses the Python lldb module to drive lldb. It is
+//    run with -python, or else the first of lldb's own Python, python3 and
+//    python that can import the module; if none can, lldb is skipped.
+//    With -gdb-backend mi, debugo instead drives gdb itself over GDB/MI,
+//    and the "script" is just the test plan in JSON. Likewise, with
+//    -lldb-backend dap, debugo drives lldb-dap, so lldb needs no Python
+//    installation matching its own: (lldb) commands run in the adapter's
+//    REPL, and (any) commands are answered as for -dap. This backend
+//    cannot run (value) tests or CORE and ATTACH markers, as -dap
+//    cannot; they are reported as SKIP, naming the adapter.
+// 5. Listen on a fresh socket to receive test results. (This proved to be much
+//    easier and more robust than trying to directly parse the output from gdb
+//    or lldb.) The scripts speak a small versioned protocol, described in
+//    protocol.go: a handshake, the results, and an explicit end-of-run message,
+//    so that a debugger that crashes partway through is reported as such.
+// 6. Execute the test script, gathering results. The debugger's stdout and
+//    stderr, interleaved, and exit status are captured in a transcript, in
+//    which each command and result is marked by a [debugo] line. With
+//    -show-output, the transcript around each failing command is printed.
+//    Use -artifacts DIR to keep the transcripts, along with the scripts and
+//    executables, each test file's under its own path in DIR, where a
+//    leading / or .. is renamed _ or __. Without -artifacts, an ERROR
+//    running the debugger includes the end of its output instead of the
+//    transcript's path.
+// 7. Repeat as needed. With -session, each debugger is started only once, and
+//    loads each test executable in turn: gdb from its script, or over MI
+//    with -gdb-backend mi, and lldb into the one SBDebugger of its script.
+//    There is one session per debugger, run after the other, not a pool of
+//    workers. If the debugger crashes, it is restarted for the remaining
+//    tests, including one it never started, unless that was the first of
+//    its session, which is reported as an ERROR instead.
 //
 package main
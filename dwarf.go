@@ -0,0 +1,178 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// openDWARF returns the DWARF data of executable, an ELF or Mach-O file.
+func openDWARF(executable string) (*dwarf.Data, error) {
+	if f, err := elf.Open(executable); err == nil {
+		defer f.Close()
+		return f.DWARF()
+	}
+	f, err := macho.Open(executable)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither ELF nor Mach-O", executable)
+	}
+	defer f.Close()
+	return f.DWARF()
+}
+
+// checkDWARF checks t's DWARF directives against t.Executable.
+func checkDWARF(t *Target) []TestResult {
+	var results []TestResult
+	d, err := openDWARF(t.Executable)
+	if err != nil {
+		return []TestResult{{Status: "ERROR", File: t.Source, Msg: "failed to read DWARF: " + err.Error()}}
+	}
+	lines, err := lineTable(d, t.Source)
+	if err != nil {
+		return []TestResult{{Status: "ERROR", File: t.Source, Msg: "failed to read line table: " + err.Error()}}
+	}
+	for _, check := range t.DWARF {
+		res := TestResult{Status: "PASS", File: t.Source, Line: check.Line}
+		var err error
+		switch check.Kind {
+		case "var":
+			err = checkVar(d, check)
+		case "line":
+			entries := lines[check.SrcLine]
+			switch {
+			case len(entries) == 0:
+				err = fmt.Errorf("no line table entries for line %d", check.SrcLine)
+			case check.IsStmt && len(stmts(entries)) == 0:
+				err = fmt.Errorf("line %d has no is_stmt entry", check.SrcLine)
+			}
+		}
+		if err != nil {
+			res.Status = "FAIL"
+			res.Msg = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// lineTable returns the entries for source in d's line tables, by line.
+func lineTable(d *dwarf.Data, source string) (map[int][]dwarf.LineEntry, error) {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	lines := make(map[int][]dwarf.LineEntry)
+	r := d.Reader()
+	for {
+		cu, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if cu == nil {
+			return lines, nil
+		}
+		if cu.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := d.LineReader(cu)
+		if err != nil {
+			return nil, err
+		}
+		if lr != nil {
+			var e dwarf.LineEntry
+			for lr.Next(&e) == nil {
+				if e.File != nil && e.File.Name == abs && !e.EndSequence {
+					lines[e.Line] = append(lines[e.Line], e)
+				}
+			}
+		}
+		r.SkipChildren()
+	}
+}
+
+// stmts returns the distinct addresses of the statement entries
+// among entries, in order.
+func stmts(entries []dwarf.LineEntry) []uint64 {
+	var addrs []uint64
+	seen := make(map[uint64]bool)
+	for _, e := range entries {
+		if e.IsStmt && !seen[e.Address] {
+			seen[e.Address] = true
+			addrs = append(addrs, e.Address)
+		}
+	}
+	return addrs
+}
+
+// checkVar checks a DWARF var directive against d. Variables in the
+// function's closures, such as main.f.func1, count too.
+func checkVar(d *dwarf.Data, check DWARFCheck) error {
+	v, err := findVar(d, check.Func, check.Var)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("no variable %s in %s", check.Var, check.Func)
+	}
+	if check.Type != "" {
+		typ := "<none>"
+		if off, ok := v.Val(dwarf.AttrType).(dwarf.Offset); ok {
+			r := d.Reader()
+			r.Seek(off)
+			if e, err := r.Next(); err == nil && e != nil {
+				typ, _ = e.Val(dwarf.AttrName).(string)
+			}
+		}
+		if typ != check.Type {
+			return fmt.Errorf("variable %s has type %s, want %s", check.Var, typ, check.Type)
+		}
+	}
+	switch have := v.Val(dwarf.AttrLocation) != nil; {
+	case check.Location == "present" && !have:
+		return fmt.Errorf("variable %s has no location", check.Var)
+	case check.Location == "absent" && have:
+		return fmt.Errorf("variable %s has a location, want none", check.Var)
+	}
+	return nil
+}
+
+// findVar returns the entry for the variable or parameter name in fn,
+// or in its closures, or nil if there is none.
+func findVar(d *dwarf.Data, fn, name string) (*dwarf.Entry, error) {
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil {
+			return nil, err
+		}
+		if e.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		sub, _ := e.Val(dwarf.AttrName).(string)
+		if (sub != fn && !strings.HasPrefix(sub, fn+".func")) || !e.Children {
+			r.SkipChildren()
+			continue
+		}
+		// Walk the subprogram's children, including lexical blocks.
+		for depth := 1; depth > 0; {
+			e, err := r.Next()
+			if err != nil || e == nil {
+				return nil, err
+			}
+			switch {
+			case e.Tag == 0:
+				depth--
+				continue
+			case (e.Tag == dwarf.TagVariable || e.Tag == dwarf.TagFormalParameter) && e.Val(dwarf.AttrName) == name:
+				return e, nil
+			}
+			if e.Children {
+				depth++
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDWARF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugo-dwarf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := "test/dwarf.go"
+	file, err := ParseFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &Target{Source: source, Executable: filepath.Join(dir, "dwarf")}
+	if err := build("go", target.Executable, source); err != nil {
+		t.Fatal(err)
+	}
+
+	target.DWARF = file.DWARF
+	for _, res := range checkDWARF(target) {
+		if res.Status != "PASS" {
+			t.Errorf("%s:%d: %s %s", res.File, res.Line, res.Status, res.Msg)
+		}
+	}
+
+	target.DWARF = []DWARFCheck{
+		{Line: 1, Kind: "var", Func: "main.main", Var: "s", Type: "int"},
+		{Line: 2, Kind: "var", Func: "main.main", Var: "nosuch"},
+		{Line: 3, Kind: "var", Func: "main.(*counter).add", Var: "delta", Location: "absent"},
+		{Line: 4, Kind: "line", SrcLine: 1},
+	}
+	wants := []string{
+		"variable s has type string, want int",
+		"no variable nosuch in main.main",
+		"variable delta has a location, want none",
+		"no line table entries for line 1",
+	}
+	results := checkDWARF(target)
+	if len(results) != len(wants) {
+		t.Fatalf("got %d results, want %d", len(results), len(wants))
+	}
+	for i, res := range results {
+		if res.Status != "FAIL" || res.Msg != wants[i] {
+			t.Errorf("check %d: got %s %q, want FAIL %q", i, res.Status, res.Msg, wants[i])
+		}
+	}
+}
+
+func TestParseDWARF(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want DWARFCheck
+		err  string
+	}{
+		{"// DWARF var i type=int location=present", DWARFCheck{Line: 7, Kind: "var", Var: "i", Type: "int", Location: "present"}, ""},
+		{"// DWARF line 12 is_stmt", DWARFCheck{Line: 7, Kind: "line", SrcLine: 12, IsStmt: true}, ""},
+		{"// DWARF line 12", DWARFCheck{Line: 7, Kind: "line", SrcLine: 12}, ""},
+		{"// DWARF var i location=maybe", DWARFCheck{}, "location"},
+		{"// DWARF var i size=8", DWARFCheck{}, "unknown DWARF var key"},
+		{"// DWARF line twelve", DWARFCheck{}, "line number"},
+		{"// DWARF type T", DWARFCheck{}, "unknown DWARF check"},
+	} {
+		check, err := parseDWARF(tt.text, 7)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want one containing %q", tt.text, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.text, err)
+		case tt.err == "" && check != tt.want:
+			t.Errorf("%s: got %+v, want %+v", tt.text, check, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// outputPath is where the program's stream ("stdout" or "stderr")
+// is written when t is run in the named debugger.
+func outputPath(t *Target, debugger, stream string) string {
+	return filepath.Join(t.RunDir, stream+"."+debugger)
+}
+
+// checkExit checks res, an EXIT result reporting how t's program exited
+// and whose stdout and stderr were written to stdoutPath and stderrPath,
+// against t.Expect.
+func checkExit(t *Target, stdoutPath, stderrPath string, res TestResult) []TestResult {
+	var results []TestResult
+	e := t.Expect
+
+	if e.Exit != nil {
+		r := TestResult{Status: "PASS", File: t.Source, Line: e.ExitLine, Have: fmt.Sprint(res.ExitCode)}
+		switch {
+		case res.Msg != "":
+			r.Status = "FAIL"
+			r.Msg = res.Msg
+		case res.ExitCode != *e.Exit:
+			r.Status = "FAIL"
+			r.Msg = fmt.Sprintf("exit status %d, want %d", res.ExitCode, *e.Exit)
+		}
+		results = append(results, r)
+	}
+	if e.Stdout != nil {
+		results = append(results, checkStream(t, "stdout", stdoutPath, e.Stdout, e.StdoutLine))
+	}
+	if e.Stderr != nil {
+		results = append(results, checkStream(t, "stderr", stderrPath, e.Stderr, e.StderrLine))
+	}
+	return results
+}
+
+// checkStream checks the program's output on stream, written to path,
+// against want, the EXPECT-STDOUT or EXPECT-STDERR regexes starting at
+// line.
+func checkStream(t *Target, stream, path string, want []string, line int) TestResult {
+	r := TestResult{File: t.Source, Line: line}
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		r.Status = "ERROR"
+		r.Msg = "failed to read program " + stream + ": " + err.Error()
+		return r
+	}
+	re, err := regexp.Compile("^" + strings.Join(want, "\n") + "$")
+	if err != nil {
+		r.Status = "ERROR"
+		r.Msg = "bad EXPECT-" + strings.ToUpper(stream) + " regex: " + err.Error()
+		return r
+	}
+	r.Have = string(out)
+	if re.Match(out) || re.MatchString(strings.TrimSuffix(r.Have, "\n")) {
+		r.Status = "PASS"
+	} else {
+		r.Status = "FAIL"
+		r.Msg = "program " + stream + " did not match"
+		r.Want = want
+	}
+	return r
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckExit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugo-expect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdout := filepath.Join(dir, "stdout")
+	if err := ioutil.WriteFile(stdout, []byte("hello\nworld 42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr := filepath.Join(dir, "stderr")
+	if err := ioutil.WriteFile(stderr, []byte("panic: boom\n\ngoroutine 1 [running]:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zero := 0
+	target := &Target{Source: "x.go", Expect: Expect{
+		Exit: &zero, ExitLine: 3,
+		Stdout: []string{"hello", `world \d+`}, StdoutLine: 4,
+	}}
+	tests := []struct {
+		res    TestResult
+		stdout string
+		want   []string // statuses
+	}{
+		{TestResult{Status: "EXIT"}, stdout, []string{"PASS", "PASS"}},
+		{TestResult{Status: "EXIT", ExitCode: 2}, stdout, []string{"FAIL", "PASS"}},
+		{TestResult{Status: "EXIT", ExitCode: -1, Msg: "killed by signal SIGSEGV"}, stdout, []string{"FAIL", "PASS"}},
+		{TestResult{Status: "EXIT"}, filepath.Join(dir, "missing"), []string{"PASS", "ERROR"}},
+	}
+	for _, tt := range tests {
+		results := checkExit(target, tt.stdout, stderr, tt.res)
+		var have []string
+		for _, r := range results {
+			have = append(have, r.Status)
+		}
+		if len(have) != len(tt.want) || have[0] != tt.want[0] || have[1] != tt.want[1] {
+			t.Errorf("checkExit(%+v, %s) = %v, want %v", tt.res, tt.stdout, have, tt.want)
+		}
+	}
+
+	target.Expect.Stdout = []string{"hello"}
+	results := checkExit(target, stdout, stderr, TestResult{Status: "EXIT"})
+	if r := results[1]; r.Status != "FAIL" || r.Line != 4 || r.Have != "hello\nworld 42\n" {
+		t.Errorf("checkExit with mismatched output = %+v", r)
+	}
+
+	target.Expect.Stderr, target.Expect.StderrLine = []string{"panic: boom", "", "goroutine 1 .*"}, 5
+	results = checkExit(target, stdout, stderr, TestResult{Status: "EXIT"})
+	if r := results[2]; r.Status != "PASS" || r.Line != 5 {
+		t.Errorf("checkExit with matching stderr = %+v", r)
+	}
+	target.Expect.Stderr = []string{"panic: bang"}
+	results = checkExit(target, stdout, stderr, TestResult{Status: "EXIT"})
+	if r := results[2]; r.Status != "FAIL" || r.Msg != "program stderr did not match" {
+		t.Errorf("checkExit with mismatched stderr = %+v", r)
+	}
+
+	if results := checkExit(&Target{}, stdout, stderr, TestResult{Status: "EXIT", ExitCode: 1}); len(results) != 0 {
+		t.Errorf("checkExit with no expectations = %+v, want none", results)
+	}
+}
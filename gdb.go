@@ -2,9 +2,8 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"os/exec"
-	"strings"
 	"text/template"
 )
 
@@ -13,99 +12,456 @@ add-auto-load-safe-path {{.GoRoot}}/src/pkg/runtime/runtime-gdb.py
 
 python
 import json
+import os
 import re
 import socket
+import sys
 
-sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
-sock.connect("{{.Sock}}")
+sock = None
+sent = 0
 
-def send_result(status, msg=None, filename=None, lineno=None):
-	res = {"status": status}
+def send(msg):
+	dump = json.dumps(msg) + "\n"
+	enc = dump.encode('ascii')
+	sock.sendall(enc)
+
+def echo(s):
+	# write s to the debugger's stdout, which goes in the transcript
+	if s and not s.endswith("\n"):
+		s += "\n"
+	sys.stdout.write(s)
+	sys.stdout.flush()
+
+def send_result(status, msg=None, filename=None, lineno=None, **fields):
+	global sent
+	# mark each result in the transcript, as transcriptLine does
+	echo("[debugo] %s %s:%d %s" % (status, filename or "", lineno or 0, ("" if msg is None else str(msg)).replace("\n", " ")))
+	res = {"type": "result", "status": status}
+	res.update(fields)
 	if msg is not None:
 		res["msg"] = str(msg)
 	if filename is not None:
 		res["file"] = filename
 	if lineno is not None:
 		res["line"] = lineno
-	dump = json.dumps(res) + "\n"
-	enc = dump.encode('ascii')
-	sock.sendall(enc)
+	send(res)
+	sent += 1
+
+def begin_run(sock_path, run_id):
+	global sock, sent
+	sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+	sock.connect(sock_path)
+	sent = 0
+	send({"type": "hello", "version": {{.Protocol}}, "run": run_id, "debugger": "gdb", "debugger_version": gdb.VERSION})
+
+def send_end():
+	send({"type": "end", "results": sent})
+	sock.close()
+
+def send_exit(filename):
+	# report how the program exited, and reset for the next run
+	code = gdb.convenience_variable("_exitcode")
+	sig = gdb.convenience_variable("_exitsignal")
+	if code is not None:
+		send_result("EXIT", None, filename, exit_code=int(code))
+	elif sig is not None:
+		send_result("EXIT", "killed by signal " + str(sig), filename, exit_code=-1)
+	else:
+		send_result("EXIT", "program did not exit", filename, exit_code=-1)
+	gdb.set_convenience_variable("_exitcode", None)
+	gdb.set_convenience_variable("_exitsignal", None)
 
-def test(command, want, filename, lineno):
+` + gdbNormalizePython + `
+# normalize_history is -normalize: whether "history" normalization is done.
+normalize_history = {{if .Normalize}}True{{else}}False{{end}}
+
+# loaded is set when a core or process has been loaded for marker tests,
+# or the program has stopped for a PANIC or SIGNAL marker, and skip when
+# the frame for a marker's tests wasn't found.
+loaded = False
+skip = False
+
+def load(command, filename):
+	global loaded
+	try:
+		gdb.execute(command, False, True)
+		loaded = True
+	except Exception as e:
+		loaded = False
+		send_result("ERROR", "failed to execute command '" + command + "': " + str(e), filename)
+
+def unload(command):
+	global loaded, skip
+	if loaded:
+		gdb.execute(command, False, True)
+	loaded = False
+	skip = False
+
+def select_frame(filename, lineno, marker):
+	# select the frame at filename:lineno in any thread
+	global skip
+	skip = True
+	if not loaded:
+		return
+	for thread in gdb.selected_inferior().threads():
+		thread.switch()
+		f = gdb.newest_frame()
+		while f is not None:
+			sal = f.find_sal()
+			if sal.symtab is not None and os.path.basename(sal.symtab.filename) == os.path.basename(filename) and sal.line == lineno:
+				f.select()
+				skip = False
+				return
+			f = f.older()
+	send_result("ERROR", "no frame at the " + marker + " marker", filename, lineno)
+
+def select_stop(filename, lineno, marker):
+	# the program has stopped for a PANIC or SIGNAL marker;
+	# select the frame that panicked or faulted
+	global loaded
+	loaded = True
+	select_frame(filename, lineno, marker)
+	loaded = False
+
+def test(command, want, filename, lineno, norm):
+	if skip:
+		return
 	send_result("RUNNING", command, filename, lineno)
 	try:
 		out = gdb.execute(command, False, True)
+		echo(out)
 	except Exception as e:
 		send_result("FAIL", "failed to execute command '" + command + "': " + str(e), filename, lineno)
 		return
+	if norm == "history" and not normalize_history:
+		norm = ""
+	out = normalize(norm, out)
 	match = re.match("^" + want + "$", out)
 	if match is None:
-		msg = "want regex {want} have {out}".format(**locals())
-		send_result("FAIL", msg, filename, lineno)
+		send_result("FAIL", "output did not match", filename, lineno, want=want.split("\n"), have=out)
 	else:
-		send_result("PASS", None, filename, lineno)
+		send_result("PASS", None, filename, lineno, have=out)
+
+def typedef_names(t):
+	# maps and channels are typedefs named map[K]V and chan T of
+	# pointers, possibly under further typedefs of named types
+	names = []
+	while t.code == gdb.TYPE_CODE_TYPEDEF:
+		names.append(str(t))
+		t = t.target()
+	return names
+
+def dump_value(v, depth=0):
+	if depth > 8:
+		return {"kind": "scalar", "value": "..."}
+	t = v.type.strip_typedefs()
+	name = str(t)
+	for n in typedef_names(v.type):
+		if n.startswith("map[") or n.startswith("chan "):
+			name = n
+	res = {"type": str(v.type)}
+	if name == "string":
+		n = int(v["len"])
+		res["kind"] = "string"
+		res["value"] = v["str"].string("utf-8", "replace", n) if n > 0 else ""
+	elif name.startswith("[]"):
+		if int(v["array"]) == 0:
+			res["kind"] = "nil"
+			return res
+		res["kind"] = "list"
+		res["children"] = [{"value": dump_value(v["array"][i], depth+1)} for i in range(int(v["len"]))]
+	elif t.code == gdb.TYPE_CODE_ARRAY:
+		lo, hi = t.range()
+		res["kind"] = "list"
+		res["children"] = [{"value": dump_value(v[i], depth+1)} for i in range(lo, hi+1)]
+	elif t.code == gdb.TYPE_CODE_PTR:
+		if int(v) == 0:
+			res["kind"] = "nil"
+		elif name.startswith("map[") or name.startswith("chan "):
+			return dump_visualized(v, res, depth)
+		else:
+			res["kind"] = "pointer"
+			res["children"] = [{"value": dump_value(v.dereference(), depth+1)}]
+	elif t.code == gdb.TYPE_CODE_STRUCT:
+		if name.startswith("map[") or name.startswith("interface") or name == "runtime.eface" or name == "runtime.iface":
+			return dump_visualized(v, res, depth)
+		res["kind"] = "struct"
+		res["children"] = [{"name": f.name, "value": dump_value(v[f], depth+1)} for f in t.fields()]
+	elif t.code == gdb.TYPE_CODE_BOOL:
+		res["kind"] = "scalar"
+		res["value"] = "true" if bool(v) else "false"
+	elif t.code in (gdb.TYPE_CODE_INT, gdb.TYPE_CODE_CHAR):
+		res["kind"] = "scalar"
+		res["value"] = str(int(v))
+	elif t.code == gdb.TYPE_CODE_FLT:
+		res["kind"] = "scalar"
+		res["value"] = repr(float(v))
+	else:
+		res["kind"] = "scalar"
+		res["value"] = str(v)
+	return res
+
+def dump_visualized(v, res, depth):
+	# maps, channels and interfaces are left to runtime-gdb.py's pretty printers
+	vis = gdb.default_visualizer(v)
+	if vis is None or not hasattr(vis, "children"):
+		res["kind"] = "scalar"
+		res["value"] = str(v)
+		return res
+	children = [c[1] for c in vis.children()]
+	hint = vis.display_hint() if hasattr(vis, "display_hint") else None
+	if hint == "map":
+		res["kind"] = "map"
+		res["children"] = [{"key": dump_value(children[i], depth+1), "value": dump_value(children[i+1], depth+1)} for i in range(0, len(children) - 1, 2)]
+	elif str(v.type.strip_typedefs()).startswith("interface") and len(children) == 1:
+		res["kind"] = "interface"
+		res["children"] = [{"value": dump_value(children[0], depth+1)}]
+	else:
+		res["kind"] = "list"
+		res["children"] = [{"value": dump_value(c, depth+1)} for c in children]
+	return res
+
+def test_value(expr, filename, lineno):
+	if skip:
+		return
+	send_result("RUNNING", expr, filename, lineno)
+	try:
+		v = gdb.parse_and_eval(expr)
+		value = dump_value(v)
+	except Exception as e:
+		send_result("FAIL", "failed to evaluate '" + expr + "': " + str(e), filename, lineno)
+		return
+	send_result("VALUE", None, filename, lineno, value=value)
+
+bp_address_re = re.compile(r"^\d+(?:\.\d+)?\s.*?\s(0x[0-9a-f]+)\s+in\s", re.M)
+
+def audit(filename, lineno):
+	# report the addresses gdb resolves a breakpoint at filename:lineno
+	# to, as when running the tests; Breakpoint.locations is new in
+	# gdb 13, so older gdbs have theirs read from info breakpoints
+	try:
+		bp = gdb.Breakpoint(filename + ":" + str(lineno))
+	except Exception as e:
+		send_result("LOCATIONS", str(e), filename, lineno)
+		return
+	try:
+		if hasattr(bp, "locations"):
+			addrs = ["0x%x" % loc.address for loc in bp.locations]
+		else:
+			addrs = bp_address_re.findall(gdb.execute("info breakpoints " + str(bp.number), False, True))
+	finally:
+		bp.delete()
+	send_result("LOCATIONS", None, filename, lineno, addresses=addrs)
 end
 
-{{range $bp := .Breakpoints}}
-	{{if .Tests}}
+{{range $t := .Targets}}
+file {{$t.Executable}}
+python begin_run({{$t.Sock | printf "%q"}}, {{$t.RunID | printf "%q"}})
+{{if $.Audit}}
+set breakpoint pending off
+{{range $bp := $t.Breakpoints}}
+	{{if eq .Kind ""}}
+		python audit({{$bp.Filename | printf "%q"}}, {{$bp.Line}})
+	{{end}}
+{{end}}
+{{else}}
+{{range $bp := $t.Breakpoints}}
+	{{if and .Tests (eq .Kind "")}}
 		tbreak {{$bp.Filename}}:{{$bp.Line}}
 		commands
 		silent
-		{{range $test := .Tests}}
-			{{if eq $test.Debugger "gdb" }}
-				python test({{$test.Command | printf "%q"}}, {{$test.Want | joinn | printf "%q"}}, {{$bp.Filename | printf "%q"}}, {{$test.Line}})
-			{{end}}
-		{{end}}
+		{{template "tests" $bp}}
 		continue
 		end
 	{{end}}
 {{end}}
-run
+{{with $bp := $t.Crash}}
+	{{if eq .Kind "panic"}}
+		tbreak runtime.gopanic
+	{{else}}
+		tcatch signal {{.Signal}}
+	{{end}}
+	commands
+	silent
+	python select_stop({{$bp.Filename | printf "%q"}}, {{$bp.StopLine}}, {{$bp.Kind | upper | printf "%q"}})
+	{{template "tests" $bp}}
+	python skip = False
+	continue
+	end
+{{end}}
+{{range $t.Env}}
+set environment {{.}}
+{{end}}
+{{if $t.Remote}}
+target remote {{$t.Remote}}
+continue
+{{else}}
+run{{args $t}} > {{output $t "stdout" | sh}} 2> {{output $t "stderr" | sh}}
+{{end}}
+python send_exit({{$t.Source | printf "%q"}})
+{{range $t.Env}}
+unset environment {{envName .}}
+{{end}}
+delete
+{{if $t.Core}}
+file {{$t.CoreExecutable}}
+python load({{printf "core-file %s" $t.Core | printf "%q"}}, {{$t.Source | printf "%q"}})
+{{template "markers" ($t.Markers "core")}}
+python unload("core-file")
+{{end}}
+{{if $t.AttachPid}}
+file {{$t.AttachExecutable}}
+python load({{printf "attach %d" $t.AttachPid | printf "%q"}}, {{$t.Source | printf "%q"}})
+{{template "markers" ($t.Markers "attach")}}
+python unload("detach")
+{{end}}
+{{end}}
+python send_end()
+{{end}}
+
+{{define "markers"}}
+	{{range $bp := .}}
+		python select_frame({{$bp.Filename | printf "%q"}}, {{$bp.Line}}, {{$bp.Kind | upper | printf "%q"}})
+		{{template "tests" $bp}}
+	{{end}}
+{{end}}
+
+{{define "tests"}}
+	{{$bp := .}}
+	{{range $test := .Tests}}
+		{{if runs $test}}
+			python test({{command $test | printf "%q"}}, {{$test.Want | joinn | printf "%q"}}, {{$bp.Filename | printf "%q"}}, {{$test.Line}}, {{$test.Normalization | printf "%q"}})
+		{{else if eq $test.Debugger "value" }}
+			python test_value({{$test.ValueRoot | printf "%q"}}, {{$bp.Filename | printf "%q"}}, {{$test.Line}})
+		{{end}}
+	{{end}}
+{{end}}
 `
 
+// gdbNormalizePython is the output normalization of the gdb script,
+// which normalize.go mirrors for the backends implemented in Go.
+// TestNormalizePython checks that the two agree.
+const gdbNormalizePython = `
+history_re = re.compile(r"^(\(.*?\) )?\$[0-9]+ = ")
+
+def join_lines(lines):
+	# join a multi-line composite value into a single line
+	out = ""
+	for l in lines:
+		l = l.strip()
+		if not l:
+			continue
+		if out.endswith(","):
+			out += " "
+		elif out and not out.endswith(("{", ", ")) and not l.startswith("}"):
+			out += ", "
+		out += l
+	return out
+
+def normalize(norm, out):
+	if norm == "history":
+		return history_re.sub(lambda m: (m.group(1) or "") + "$N = ", out, count=1)
+	if norm == "print":
+		return normalize_print(out)
+	if norm == "locals":
+		return normalize_locals(out)
+	if norm == "bt":
+		return normalize_bt(out)
+	return out
+
+type_re = re.compile(r"^\(.*?\) (?=0x)")
+
+def normalize_print(out):
+	out = history_re.sub("", out, count=1)
+	return type_re.sub("", join_lines(out.splitlines()))
+
+def normalize_locals(out):
+	locals = []
+	for l in out.splitlines():
+		name, sep, value = l.strip().partition(" = ")
+		if sep:
+			locals.append(name + sep + type_re.sub("", value))
+	return "\n".join(sorted(locals))
+
+gdb_frame_re = re.compile(r"^#([0-9]+)\s+(?:0x[0-9a-f]+ in )?(\S+) \(.*?\)(?: at (\S+):([0-9]+))?")
+
+def normalize_bt(out):
+	frames = []
+	for l in out.splitlines():
+		m = gdb_frame_re.match(l)
+		if m is None:
+			continue
+		frame = "#" + m.group(1) + " " + m.group(2)
+		if m.group(3):
+			frame += " at " + os.path.basename(m.group(3)) + ":" + m.group(4)
+		frames.append(frame)
+	return "\n".join(frames)
+`
+
+// gdbPortable translates portable (any) commands into gdb commands.
+var gdbPortable = map[string]string{
+	"print":  "print %s",
+	"locals": "info locals",
+	"bt":     "bt",
+}
+
 // Gdb is all gdb-related context.
 type Gdb struct {
 	Path     string // path to gdb
+	Caps     *GdbCapabilities
 	Template *template.Template
 }
 
 func (g *Gdb) Init() error {
-	path, err := exec.LookPath("gdb")
+	path, err := exec.LookPath(gdbName())
 	if err != nil {
 		return err
 	}
 	g.Path = path
 
-	funcMap := template.FuncMap{
-		"joinn": func(v interface{}) (string, error) {
-			slice, ok := v.([]string)
-			if !ok {
-				return "", fmt.Errorf("expected []string, got %v (%T)", v, v)
-			}
-			return strings.Join(slice, "\n"), nil
-		},
+	caps, err := probeGdb(path)
+	if err != nil {
+		return err
 	}
+	g.Caps = caps
 
-	g.Template = template.Must(template.New("script").Funcs(funcMap).Parse(gdbScriptTemplate))
-
-	// TODO: Check gdb version
+	g.Template = newScriptTemplate(g, gdbScriptTemplate)
 	return nil
 }
 
-func (g *Gdb) Run(executable string, scriptPath string) error {
+func (g *Gdb) Run(executable string, scriptPath string, stdout, stderr io.Writer) error {
 	cmd := exec.Command(g.Path, executable,
 		"--batch",
-		"--return-child-result",
 		"--command", scriptPath,
 		"--nx", // ignore .gdbinit
 	)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	if *debug {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
 		fmt.Println("Running", cmd)
 	}
 	return cmd.Run()
 }
 
+func (g *Gdb) Capable(capability string) string { return g.Caps.Capable(capability) }
+
+// Needs implements capable: the script is Python. Without it, use
+// -gdb-backend mi.
+func (g *Gdb) Needs() []string { return []string{"gdb-python"} }
+
+func (g *Gdb) probeToolchain(goTool, goRoot string) error {
+	if err := g.Caps.probeToolchain(goTool, goRoot); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("[gdb] %v\n", g.Caps)
+	}
+	return nil
+}
+
+func (g *Gdb) Translate(verb, arg string) (string, error) {
+	return translate(gdbPortable, verb, arg)
+}
+
 func (g *Gdb) ScriptTemplate() *template.Template { return g.Template }
 func (g *Gdb) Name() string                       { return "gdb" }
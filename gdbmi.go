@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// GdbMI is a gdb backend that drives gdb --interpreter=mi3 from Go,
+// rather than generating a command script. It does not depend on gdb's
+// embedded Python, and gets stop locations directly from gdb.
+type GdbMI struct {
+	Path     string // path to gdb
+	Caps     *GdbCapabilities
+	Template *template.Template
+
+	normalize bool // the plan's ScriptContext.Normalize, set by Run
+}
+
+func (g *GdbMI) Init() error {
+	path, err := exec.LookPath(gdbName())
+	if err != nil {
+		return err
+	}
+	g.Path = path
+	caps, err := probeGdb(path)
+	if err != nil {
+		return err
+	}
+	g.Caps = caps
+	g.Template = newScriptTemplate(g, planTemplate)
+	return nil
+}
+
+func (g *GdbMI) Capable(capability string) string { return g.Caps.Capable(capability) }
+
+func (g *GdbMI) Needs() []string { return nil }
+
+func (g *GdbMI) probeToolchain(goTool, goRoot string) error {
+	if err := g.Caps.probeToolchain(goTool, goRoot); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("[gdb] %v\n", g.Caps)
+	}
+	return nil
+}
+
+func (g *GdbMI) Run(executable string, scriptPath string, stdout, stderr io.Writer) error {
+	dot, err := readPlan(scriptPath)
+	if err != nil {
+		return err
+	}
+	g.normalize = dot.Normalize
+
+	cmd := exec.Command(g.Path, "--interpreter=mi3", "--nx", "--quiet")
+	cmd.Stderr = stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Commands and their output both go to the transcript.
+	c := &miConn{
+		w:          io.MultiWriter(in, stdout),
+		r:          bufio.NewReader(io.TeeReader(out, stdout)),
+		transcript: stdout,
+	}
+	if err := g.session(c, dot); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	in.Close()
+	return cmd.Wait()
+}
+
+// session runs the targets in dot in order.
+func (g *GdbMI) session(c *miConn, dot ScriptContext) error {
+	version, err := c.console("show version")
+	if err != nil {
+		return err
+	}
+	if i := strings.IndexByte(version, '\n'); i >= 0 {
+		version = version[:i]
+	}
+	if _, err := c.console("add-auto-load-safe-path " + dot.GoRoot); err != nil {
+		return err
+	}
+	if _, _, err := c.command("-enable-pretty-printing"); err != nil {
+		return err
+	}
+	for _, t := range dot.Targets {
+		run := g.runTarget
+		if dot.Audit {
+			run = g.auditTarget
+		}
+		if err := run(c, t, version); err != nil {
+			return err
+		}
+	}
+	_, _, err = c.command("-gdb-exit")
+	return err
+}
+
+// auditTarget reports the addresses gdb resolves t's BREAKPOINT lines to.
+// A non-nil error means that gdb itself can no longer be used.
+func (g *GdbMI) auditTarget(c *miConn, t *Target, version string) error {
+	rc, err := dialReport(t.Sock, t.RunID, g.Name(), version, c.transcript)
+	if err != nil {
+		return err
+	}
+	if _, _, err := c.command("-file-exec-and-symbols " + miQuote(t.Executable)); err != nil {
+		rc.send(TestResult{Status: "ERROR", Msg: "failed to load executable: " + err.Error()})
+		return rc.end()
+	}
+	for _, bp := range t.Breakpoints {
+		if bp.Kind != "" {
+			continue
+		}
+		// Resolve the line as the test run does, by setting a
+		// breakpoint there.
+		res := TestResult{Status: "LOCATIONS", File: bp.Filename, Line: bp.Line}
+		r, _, err := c.command("-break-insert " + miQuote(fmt.Sprintf("%s:%d", bp.Filename, bp.Line)))
+		if err != nil {
+			res.Msg = err.Error()
+		} else {
+			res.Addresses = miBreakpointAddresses(r)
+			if _, _, err := c.command("-break-delete"); err != nil {
+				return err
+			}
+		}
+		if err := rc.send(res); err != nil {
+			return err
+		}
+	}
+	return rc.end()
+}
+
+// runTarget runs the tests for t, reporting to t.Sock. A non-nil error
+// means that gdb itself can no longer be used.
+func (g *GdbMI) runTarget(c *miConn, t *Target, version string) error {
+	rc, err := dialReport(t.Sock, t.RunID, g.Name(), version, c.transcript)
+	if err != nil {
+		return err
+	}
+
+	// abort reports an error and ends the run, leaving gdb
+	// ready for the next target.
+	abort := func(filename string, lineno int, msg string) error {
+		rc.send(TestResult{Status: "ERROR", File: filename, Line: lineno, Msg: msg})
+		c.console("kill")
+		c.command("-break-delete")
+		return rc.end()
+	}
+
+	if _, _, err := c.command("-file-exec-and-symbols " + miQuote(t.Executable)); err != nil {
+		return abort("", 0, "failed to load executable: "+err.Error())
+	}
+
+	bps := make(map[string]Breakpoint) // by gdb breakpoint number
+	for _, bp := range t.Breakpoints {
+		if len(bp.Tests) == 0 || bp.Kind != "" {
+			continue
+		}
+		loc := fmt.Sprintf("%s:%d", bp.Filename, bp.Line)
+		r, _, err := c.command("-break-insert -t " + miQuote(loc))
+		if err != nil {
+			return abort(bp.Filename, bp.Line, "failed to set breakpoint: "+err.Error())
+		}
+		bkpt, _ := r.Results["bkpt"].(map[string]interface{})
+		number, _ := bkpt["number"].(string)
+		bps[number] = bp
+	}
+
+	// A PANIC marker's tests run at a breakpoint on runtime.gopanic, and
+	// a SIGNAL marker's when gdb stops for the signal, which it is told to.
+	crash := t.Crash()
+	var panicBkpt string
+	if crash != nil && crash.Kind == "panic" {
+		r, _, err := c.command("-break-insert -t runtime.gopanic")
+		if err != nil {
+			return abort(crash.Filename, crash.Line, "failed to set breakpoint on runtime.gopanic: "+err.Error())
+		}
+		bkpt, _ := r.Results["bkpt"].(map[string]interface{})
+		panicBkpt, _ = bkpt["number"].(string)
+	}
+	if crash != nil && crash.Kind == "signal" {
+		info, err := c.console("info signals " + crash.Signal)
+		if err == nil {
+			_, err = c.console("handle " + crash.Signal + " stop print pass")
+		}
+		if err != nil {
+			return abort(crash.Filename, crash.Line, "failed to catch signal: "+err.Error())
+		}
+		// Leave gdb as it was for the next target.
+		if handling := signalHandling(info, crash.Signal); handling != "" {
+			defer c.console("handle " + crash.Signal + handling)
+		}
+	}
+
+	for _, kv := range t.Env {
+		if _, err := c.console("set environment " + kv); err != nil {
+			return abort("", 0, "failed to set environment: "+err.Error())
+		}
+	}
+	if t.Remote != "" {
+		// The program is already running, under qemu-user, which
+		// took care of its arguments, environment and output.
+		if _, _, err := c.command("-target-select remote " + t.Remote); err != nil {
+			return abort("", 0, "failed to connect to qemu: "+err.Error())
+		}
+		if _, _, err := c.command("-exec-continue"); err != nil {
+			return abort("", 0, "failed to continue: "+err.Error())
+		}
+	} else {
+		// The program's terminal is /dev/null, so that nothing it
+		// writes, other than to the redirected stdout and stderr,
+		// can mix with the MI output.
+		if _, _, err := c.command("-inferior-tty-set /dev/null"); err != nil {
+			return abort("", 0, "failed to set the program's terminal: "+err.Error())
+		}
+		// gdb passes the arguments through a shell, as for run.
+		redirect := " > " + shellQuote(outputPath(t, g.Name(), "stdout")) + " 2> " + shellQuote(outputPath(t, g.Name(), "stderr"))
+		if _, _, err := c.command("-exec-arguments" + shellArgs(t) + redirect); err != nil {
+			return abort("", 0, "failed to set arguments: "+err.Error())
+		}
+		if _, _, err := c.command("-exec-run"); err != nil {
+			return abort("", 0, "failed to run: "+err.Error())
+		}
+	}
+	for {
+		stop, err := c.waitStop()
+		if err != nil {
+			// gdb is gone; leave the run truncated.
+			return err
+		}
+		switch reason := stop.String("reason"); reason {
+		case "exited-normally", "exited", "exited-signalled":
+			if err := rc.send(exitResult(t, stop)); err != nil {
+				return err
+			}
+			if _, _, err := c.command("-break-delete"); err != nil {
+				return err
+			}
+			for _, kv := range t.Env {
+				if _, err := c.console("unset environment " + envName(kv)); err != nil {
+					return err
+				}
+			}
+			if t.Core != "" {
+				err := g.runMarkers(c, rc, t, "core", t.CoreExecutable, "-target-select core "+miQuote(t.Core), "core-file")
+				if err != nil {
+					return err
+				}
+			}
+			if t.AttachPid != 0 {
+				err := g.runMarkers(c, rc, t, "attach", t.AttachExecutable, fmt.Sprintf("-target-attach %d", t.AttachPid), "detach")
+				if err != nil {
+					return err
+				}
+			}
+			return rc.end()
+		case "breakpoint-hit", "signal-received":
+			if crash != nil && (reason == "breakpoint-hit" && stop.String("bkptno") == panicBkpt ||
+				reason == "signal-received" && crash.Kind == "signal" && stop.String("signal-name") == crash.Signal) {
+				// Run the tests once, in the frame that panicked
+				// or faulted, then let the program carry on dying.
+				if err := g.runCrash(c, rc, *crash); err != nil {
+					return err
+				}
+				crash = nil
+				if _, _, err := c.command("-exec-continue"); err != nil {
+					return abort("", 0, "failed to continue: "+err.Error())
+				}
+				continue
+			}
+			if reason == "signal-received" {
+				return abort("", 0, fmt.Sprintf("stopped by signal %s at %s", stop.String("signal-name"), stopLocation(stop)))
+			}
+			bp, ok := bps[stop.String("bkptno")]
+			if !ok {
+				return abort("", 0, "stopped at an unrecognized breakpoint at "+stopLocation(stop))
+			}
+			if err := g.runTests(c, rc, bp); err != nil {
+				return err
+			}
+			if _, _, err := c.command("-exec-continue"); err != nil {
+				return abort(bp.Filename, bp.Line, "failed to continue: "+err.Error())
+			}
+		default:
+			return abort("", 0, fmt.Sprintf("stopped unexpectedly (%s) at %s", reason, stopLocation(stop)))
+		}
+	}
+}
+
+// runMarkers runs the tests attached to t's markers of the given kind,
+// with executable loaded, after running the MI command load, and
+// before the console command unload.
+func (g *GdbMI) runMarkers(c *miConn, rc *reportConn, t *Target, kind, executable, load, unload string) error {
+	fail := func(msg string) error {
+		return rc.send(TestResult{Status: "ERROR", File: t.Source, Msg: msg})
+	}
+	if _, _, err := c.command("-file-exec-and-symbols " + miQuote(executable)); err != nil {
+		return fail("failed to load executable: " + err.Error())
+	}
+	if _, _, err := c.command(load); err != nil {
+		return fail("failed to execute command '" + load + "': " + err.Error())
+	}
+	for _, bp := range t.Markers(kind) {
+		if err := selectFrame(c, bp.Filename, bp.Line); err != nil {
+			msg := fmt.Sprintf("no frame at the %s marker: %v", strings.ToUpper(kind), err)
+			if err := rc.send(TestResult{Status: "ERROR", File: bp.Filename, Line: bp.Line, Msg: msg}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := g.runTests(c, rc, bp); err != nil {
+			return err
+		}
+	}
+	_, err := c.console(unload)
+	return err
+}
+
+// runCrash runs the tests attached to bp, a PANIC or SIGNAL
+// marker, in the frame that panicked or faulted.
+func (g *GdbMI) runCrash(c *miConn, rc *reportConn, bp Breakpoint) error {
+	if err := selectFrame(c, bp.Filename, bp.StopLine); err != nil {
+		msg := fmt.Sprintf("no frame at the %s marker: %v", strings.ToUpper(bp.Kind), err)
+		return rc.send(TestResult{Status: "ERROR", File: bp.Filename, Line: bp.StopLine, Msg: msg})
+	}
+	return g.runTests(c, rc, bp)
+}
+
+// signalHandling returns gdb's handling of sig, as arguments to
+// handle, from the output of info signals. It returns "" if the
+// output doesn't say.
+func signalHandling(info, sig string) string {
+	for _, line := range strings.Split(info, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 4 || f[0] != sig {
+			continue
+		}
+		var handling string
+		for i, action := range []string{"stop", "print", "pass"} {
+			switch f[i+1] {
+			case "Yes":
+				handling += " " + action
+			case "No":
+				handling += " no" + action
+			default:
+				return ""
+			}
+		}
+		return handling
+	}
+	return ""
+}
+
+// selectFrame selects the frame at filename:lineno, in any thread.
+func selectFrame(c *miConn, filename string, lineno int) error {
+	r, _, err := c.command("-thread-info")
+	if err != nil {
+		return err
+	}
+	threads, _ := r.Results["threads"].([]interface{})
+	for _, thread := range threads {
+		id, _ := thread.(map[string]interface{})["id"].(string)
+		if _, _, err := c.command("-thread-select " + id); err != nil {
+			return err
+		}
+		r, _, err := c.command("-stack-list-frames")
+		if err != nil {
+			continue
+		}
+		frames, _ := r.Results["stack"].([]interface{})
+		for _, frame := range frames {
+			f, _ := frame.(map[string]interface{})
+			file, _ := f["file"].(string)
+			line, _ := f["line"].(string)
+			if filepath.Base(file) == filepath.Base(filename) && line == strconv.Itoa(lineno) {
+				level, _ := f["level"].(string)
+				_, _, err := c.command("-stack-select-frame " + level)
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("not found in any thread")
+}
+
+// runTests runs the tests attached to bp, which has just been hit.
+func (g *GdbMI) runTests(c *miConn, rc *reportConn, bp Breakpoint) error {
+	for _, t := range bp.Tests {
+		var res TestResult
+		switch {
+		case runs(g, t):
+			cmd, err := command(g, t)
+			if err != nil {
+				return err
+			}
+			rc.send(TestResult{Status: "RUNNING", File: bp.Filename, Line: t.Line, Msg: cmd})
+			out, err := c.console(cmd)
+			if err != nil {
+				res = TestResult{Status: "FAIL", File: bp.Filename, Line: t.Line, Msg: "failed to execute command '" + cmd + "': " + err.Error()}
+				break
+			}
+			res = checkOutput("gdb", t, bp.Filename, out, g.normalize)
+		case t.Debugger == "value":
+			root, err := t.ValueRoot()
+			if err != nil {
+				return err
+			}
+			rc.send(TestResult{Status: "RUNNING", File: bp.Filename, Line: t.Line, Msg: root})
+			v, err := g.value(c, root)
+			if err != nil {
+				res = TestResult{Status: "FAIL", File: bp.Filename, Line: t.Line, Msg: "failed to evaluate '" + root + "': " + err.Error()}
+				break
+			}
+			res = TestResult{Status: "VALUE", File: bp.Filename, Line: t.Line, Value: v}
+		default:
+			continue
+		}
+		if err := rc.send(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exitResult returns the EXIT result for stop, a *stopped record
+// reporting that t's program exited.
+func exitResult(t *Target, stop miRecord) TestResult {
+	res := TestResult{Status: "EXIT", File: t.Source}
+	switch stop.String("reason") {
+	case "exited":
+		// The exit code is in octal.
+		code, err := strconv.ParseInt(stop.String("exit-code"), 8, 0)
+		res.ExitCode = int(code)
+		if err != nil {
+			res.ExitCode = -1
+			res.Msg = "bad exit code " + stop.String("exit-code")
+		}
+	case "exited-signalled":
+		res.ExitCode = -1
+		res.Msg = "killed by signal " + stop.String("signal-name")
+	}
+	return res
+}
+
+// stopLocation describes where a *stopped record says we are.
+func stopLocation(stop miRecord) string {
+	frame, _ := stop.Results["frame"].(map[string]interface{})
+	fn, _ := frame["func"].(string)
+	file, _ := frame["file"].(string)
+	line, _ := frame["line"].(string)
+	if file == "" {
+		return fn
+	}
+	return fmt.Sprintf("%s %s:%s", fn, file, line)
+}
+
+// An miVar is a gdb variable object.
+type miVar struct {
+	name, exp, typ, value, hint string
+	numchild                    int
+}
+
+func newMIVar(r map[string]interface{}) miVar {
+	str := func(k string) string { s, _ := r[k].(string); return s }
+	n, _ := strconv.Atoi(str("numchild"))
+	return miVar{name: str("name"), exp: str("exp"), typ: str("type"), value: str("value"), hint: str("displayhint"), numchild: n}
+}
+
+// value evaluates expr using variable objects, which are
+// rendered by runtime-gdb.py's pretty printers where available.
+func (g *GdbMI) value(c *miConn, expr string) (*Value, error) {
+	r, _, err := c.command("-var-create - * " + miQuote(expr))
+	if err != nil {
+		return nil, err
+	}
+	v := newMIVar(r.Results)
+	defer c.command("-var-delete " + v.name)
+	return g.varValue(c, v, 0)
+}
+
+func (g *GdbMI) varValue(c *miConn, v miVar, depth int) (*Value, error) {
+	res := &Value{Type: v.typ}
+	if depth > 8 {
+		res.Kind = "scalar"
+		res.Value = "..."
+		return res, nil
+	}
+	children := func() ([]miVar, error) {
+		r, _, err := c.command("-var-list-children --all-values " + v.name)
+		if err != nil {
+			return nil, err
+		}
+		list, _ := r.Results["children"].([]interface{})
+		var vars []miVar
+		for _, child := range list {
+			if m, ok := child.(map[string]interface{}); ok {
+				vars = append(vars, newMIVar(m))
+			}
+		}
+		return vars, nil
+	}
+	addChildren := func(named bool) error {
+		vars, err := children()
+		if err != nil {
+			return err
+		}
+		for _, cv := range vars {
+			cval, err := g.varValue(c, cv, depth+1)
+			if err != nil {
+				return err
+			}
+			child := Child{Value: cval}
+			if named {
+				child.Name = cv.exp
+			}
+			res.Children = append(res.Children, child)
+		}
+		return nil
+	}
+
+	switch {
+	case v.typ == "string" || v.hint == "string":
+		res.Kind = "string"
+		s := v.value
+		if u, err := strconv.Unquote(s); err == nil {
+			s = u
+		} else {
+			s = strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`)
+		}
+		res.Value = s
+	case (strings.HasPrefix(v.typ, "[]") || strings.HasPrefix(v.typ, "map[")) && g.isNil(c, v):
+		res.Kind = "nil"
+	case strings.HasPrefix(v.typ, "map[") || v.hint == "map":
+		res.Kind = "map"
+		vars, err := children()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(vars); i += 2 {
+			k, err := g.varValue(c, vars[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			val, err := g.varValue(c, vars[i+1], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			res.Children = append(res.Children, Child{Key: k, Value: val})
+		}
+	case strings.HasPrefix(v.typ, "[") || v.hint == "array":
+		res.Kind = "list"
+		if err := addChildren(false); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(v.typ, "*"):
+		if v.value == "0x0" {
+			res.Kind = "nil"
+			break
+		}
+		res.Kind = "pointer"
+		vars, err := children()
+		if err != nil {
+			return nil, err
+		}
+		// gdb shows a pointer to a struct as the struct's fields,
+		// and any other pointer as a single child, *p.
+		pointee := &Value{Kind: "struct", Type: strings.TrimPrefix(v.typ, "*")}
+		if len(vars) == 1 && strings.HasPrefix(vars[0].exp, "*") {
+			if pointee, err = g.varValue(c, vars[0], depth+1); err != nil {
+				return nil, err
+			}
+		} else {
+			for _, cv := range vars {
+				cval, err := g.varValue(c, cv, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				pointee.Children = append(pointee.Children, Child{Name: cv.exp, Value: cval})
+			}
+		}
+		res.Children = []Child{{Value: pointee}}
+	case v.numchild > 0:
+		res.Kind = "struct"
+		if err := addChildren(true); err != nil {
+			return nil, err
+		}
+	default:
+		res.Kind = "scalar"
+		res.Value = v.value
+		// Bytes and runes print as 97 'a'.
+		if i := strings.Index(res.Value, " '"); i > 0 {
+			res.Value = res.Value[:i]
+		}
+	}
+	return res, nil
+}
+
+// isNil reports whether v, a slice or map, is nil, which the pretty
+// printers show as empty. It reports false if that can't be told, as
+// for the children of pretty-printed values, which have no path.
+func (g *GdbMI) isNil(c *miConn, v miVar) bool {
+	r, _, err := c.command("-var-info-path-expression " + v.name)
+	if err != nil {
+		return false
+	}
+	expr := "(" + r.String("path_expr") + ")"
+	if strings.HasPrefix(v.typ, "[]") {
+		expr += ".array"
+	} else {
+		expr = "(void *)" + expr
+	}
+	r, _, err = c.command("-data-evaluate-expression " + miQuote(expr))
+	if err != nil {
+		return false
+	}
+	value := r.String("value")
+	return value == "0x0" || strings.HasPrefix(value, "0x0 ")
+}
+
+func (g *GdbMI) Translate(verb, arg string) (string, error) {
+	return translate(gdbPortable, verb, arg)
+}
+
+func (g *GdbMI) ScriptTemplate() *template.Template { return g.Template }
+func (g *GdbMI) Name() string                       { return "gdb" }
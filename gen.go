@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A genKind is a kind of value covered by debugo gen. Its program
+// declares representative variables in main, one statement per line,
+// using the types declared in types.
+type genKind struct {
+	name  string
+	doc   string // completes "tests the debuggers' rendering of"
+	types string
+	vars  string
+}
+
+var genKinds = []genKind{
+	{"numbers", "integers, floats and booleans", "", `
+		i := -5
+		i8 := int8(-8)
+		i16 := int16(1600)
+		i32 := int32(-32)
+		i64 := int64(1) << 40
+		u := uint(7)
+		u8 := uint8(255)
+		u16 := uint16(65535)
+		u32 := uint32(1) << 31
+		u64 := uint64(1) << 63
+		up := uintptr(0x1000)
+		f32 := float32(1.5)
+		f64 := -0.25
+		t := true
+		var f bool
+		r := 'x'
+		b := byte('A')
+	`},
+	{"strings", "strings", "", `
+		s := "hello"
+		empty := ""
+		unicode := "héllo, 世界"
+		escapes := "a\nb\t\"c\""
+	`},
+	{"slices", "slices", "", `
+		ints := []int{1, 2, 3}
+		strs := []string{"a", "b"}
+		nested := [][]int{{1}, {2, 3}}
+		bytes := []byte{'h', 'i'}
+		empty := []int{}
+		var nilSlice []int
+	`},
+	{"maps", "maps", "", `
+		m := map[string]int{"a": 1, "b": 2}
+		byInt := map[int]string{1: "one"}
+		nested := map[string][]int{"x": {1, 2}}
+		empty := map[string]bool{}
+		var nilMap map[string]int
+	`},
+	{"channels", "channels", "", `
+		ch := make(chan int)
+		buffered := make(chan string, 2)
+		var nilChan chan int
+	`},
+	{"interfaces", "interfaces", `
+		type Shape interface{ Area() int }
+
+		type Square struct{ Side int }
+
+		func (s Square) Area() int { return s.Side * s.Side }
+	`, `
+		var i interface{} = 7
+		var s interface{} = "x"
+		var shape Shape = Square{2}
+		var ptr interface{} = &Square{3}
+		var nilIface interface{}
+		var nilShape Shape
+	`},
+	{"structs", "structs", `
+		type T struct {
+			I int
+			S string
+			F float64
+		}
+
+		type Outer struct {
+			T T
+			P *T
+			L []int
+		}
+	`, `
+		t := T{1, "a", 1.5}
+		keyed := T{S: "b"}
+		outer := Outer{T: T{2, "x", 0}, P: &T{3, "y", 0}, L: []int{4}}
+		empty := struct{}{}
+		anon := struct{ X, Y int }{1, 2}
+		var zero T
+	`},
+	{"pointers", "pointers", `
+		type T struct {
+			I int
+			S string
+		}
+	`, `
+		n := 42
+		p := &n
+		pp := &p
+		pt := &T{1, "a"}
+		var nilPtr *int
+	`},
+	{"arrays", "arrays", "", `
+		a := [3]int{1, 2, 3}
+		strs := [2]string{"x", "y"}
+		grid := [2][2]int{{1, 2}, {3, 4}}
+		partial := [3]int{7}
+		var zero [2]bool
+	`},
+	{"complex", "complex numbers", "", `
+		c64 := complex64(1 + 2i)
+		c128 := complex(3.5, -1)
+		var zero complex128
+	`},
+	{"funcs", "func values", `
+		func double(x int) int { return 2 * x }
+	`, `
+		f := double
+		closure := func(a, b int) int { return a + b }
+		var nilFunc func()
+	`},
+	{"generics", "instances of generic types", `
+		type Pair[K comparable, V any] struct {
+			Key K
+			Val V
+		}
+
+		type List[T any] struct{ Items []T }
+	`, `
+		p := Pair[string, int]{"a", 1}
+		l := List[float64]{Items: []float64{1.5, 2}}
+		ptr := &Pair[int, bool]{Key: 1, Val: true}
+		var zero Pair[string, []int]
+	`},
+}
+
+// addressRe matches the output of (any) print for values without a Go
+// literal form, such as channels and funcs, which print as addresses.
+const addressRe = `.*0x[0-9a-f]+.*`
+
+// gen implements debugo gen, which writes a test program for each
+// kind of value, with tests computed from the values declared.
+func gen(args []string) {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	dir := flags.String("o", ".", "write the test programs to `dir`")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s gen [-o dir] [kind ...]\n\n", os.Args[0])
+		flags.PrintDefaults()
+		var names []string
+		for _, k := range genKinds {
+			names = append(names, k.name)
+		}
+		fmt.Fprintf(os.Stderr, "\nkinds: %s\n", strings.Join(names, ", "))
+		os.Exit(2)
+	}
+	flags.Parse(args)
+
+	kinds := genKinds
+	if flags.NArg() > 0 {
+		kinds = nil
+	Names:
+		for _, name := range flags.Args() {
+			for _, k := range genKinds {
+				if k.name == name {
+					kinds = append(kinds, k)
+					continue Names
+				}
+			}
+			fmt.Fprintf(os.Stderr, "unknown kind %q\n", name)
+			flags.Usage()
+		}
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fatal(err)
+	}
+	for _, k := range kinds {
+		src, err := k.generate()
+		if err != nil {
+			fatal(fmt.Errorf("generating %s: %v", k.name, err))
+		}
+		filename := filepath.Join(*dir, k.name+".go")
+		if err := ioutil.WriteFile(filename, src, 0644); err != nil {
+			fatal(err)
+		}
+		if *verbose {
+			fmt.Println("Wrote", filename)
+		}
+	}
+}
+
+// generate returns k's test program.
+func (k genKind) generate() ([]byte, error) {
+	// Type check the program without its tests, then
+	// compute the tests from the variables' values.
+	src := k.source(nil)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, k.name+".go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{
+		info: &types.Info{
+			Types: make(map[ast.Expr]types.TypeAndValue),
+			Defs:  make(map[*ast.Ident]types.Object),
+			Uses:  make(map[*ast.Ident]types.Object),
+		},
+		want: make(map[types.Object]string),
+	}
+	if g.pkg, err = new(types.Config).Check("main", fset, []*ast.File{f}, g.info); err != nil {
+		return nil, err
+	}
+	var tests []string
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "main" {
+			for _, stmt := range fn.Body.List {
+				tests = append(tests, g.tests(stmt)...)
+			}
+		}
+	}
+	return format.Source(k.source(tests))
+}
+
+// source returns k's program, with the given test lines
+// after its BREAKPOINT.
+func (k genKind) source(tests []string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by debugo gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "// %s tests the debuggers' rendering of %s.\n", k.name, k.doc)
+	fmt.Fprintf(&buf, "package main\n%s\nfunc main() {\n", dedent(k.types))
+	var names []string
+	for _, line := range strings.Split(dedent(k.vars), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "\t%s\n", line)
+		name := strings.Fields(strings.TrimPrefix(line, "var "))[0]
+		names = append(names, name)
+	}
+	fmt.Fprintf(&buf, "\t// BREAKPOINT\n")
+	for _, test := range tests {
+		fmt.Fprintf(&buf, "\t// %s\n", test)
+	}
+	fmt.Fprintf(&buf, "\tuse(%s)\n}\n\n", strings.Join(names, ", "))
+	fmt.Fprintf(&buf, "// use keeps variables live at the BREAKPOINT.\nfunc use(...interface{}) {}\n")
+	return buf.Bytes()
+}
+
+// dedent removes the indentation of the catalog's source snippets.
+func dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimPrefix(l, "\t\t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// A generator computes the tests for a type checked program.
+type generator struct {
+	pkg  *types.Package
+	info *types.Info
+	want map[types.Object]string // Go expressions for the variables so far
+}
+
+// tests returns the test lines for the variable declared by stmt.
+func (g *generator) tests(stmt ast.Stmt) []string {
+	var name *ast.Ident
+	var value ast.Expr
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		name, value = s.Lhs[0].(*ast.Ident), s.Rhs[0]
+	case *ast.DeclStmt:
+		spec := s.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+		name = spec.Names[0]
+		if len(spec.Values) > 0 {
+			value = spec.Values[0]
+		}
+	default:
+		return nil
+	}
+	obj := g.info.Defs[name]
+	want, ok := g.zero(obj.Type())
+	if value != nil {
+		want, ok = g.expr(value)
+	}
+	if !ok {
+		return []string{"(any) print " + name.Name, addressRe}
+	}
+	g.want[obj] = want
+	return []string{fmt.Sprintf("(value) %s == %s", name.Name, want)}
+}
+
+// expr returns a Go expression, as understood by matchValue, for the
+// value of x. It reports false if the value has no such expression.
+func (g *generator) expr(x ast.Expr) (string, bool) {
+	tv := g.info.Types[x]
+	if tv.Value != nil {
+		return constString(tv.Value), true
+	}
+	switch x := x.(type) {
+	case *ast.Ident:
+		if x.Name == "nil" {
+			return "nil", true
+		}
+		want, ok := g.want[g.info.Uses[x]]
+		return want, ok
+	case *ast.ParenExpr:
+		return g.expr(x.X)
+	case *ast.UnaryExpr:
+		if x.Op != token.AND {
+			break
+		}
+		want, ok := g.expr(x.X)
+		if strings.HasPrefix(want, "&") {
+			want = "(" + want + ")"
+		}
+		return "&" + want, ok
+	case *ast.CompositeLit:
+		return g.composite(x, tv.Type)
+	}
+	return "", false
+}
+
+// composite returns the Go expression for x, a composite literal of type t,
+// with elided types filled in and struct fields given in full.
+func (g *generator) composite(x *ast.CompositeLit, t types.Type) (string, bool) {
+	var elems []string
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		fields := make([]string, u.NumFields())
+		for i := range fields {
+			var ok bool
+			if fields[i], ok = g.zero(u.Field(i).Type()); !ok {
+				return "", false
+			}
+		}
+		for i, elt := range x.Elts {
+			field := i
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				for j := 0; j < u.NumFields(); j++ {
+					if u.Field(j).Name() == kv.Key.(*ast.Ident).Name {
+						field = j
+					}
+				}
+				elt = kv.Value
+			}
+			var ok bool
+			if fields[field], ok = g.elem(elt, u.Field(field).Type()); !ok {
+				return "", false
+			}
+		}
+		for i, f := range fields {
+			elems = append(elems, u.Field(i).Name()+": "+f)
+		}
+		return g.typeString(t) + "{" + strings.Join(elems, ", ") + "}", true
+	case *types.Slice, *types.Array:
+		elem := u.(interface{ Elem() types.Type }).Elem()
+		for _, elt := range x.Elts {
+			if _, ok := elt.(*ast.KeyValueExpr); ok {
+				return "", false
+			}
+			want, ok := g.elem(elt, elem)
+			if !ok {
+				return "", false
+			}
+			elems = append(elems, want)
+		}
+		if a, ok := u.(*types.Array); ok {
+			for int64(len(elems)) < a.Len() {
+				zero, ok := g.zero(elem)
+				if !ok {
+					return "", false
+				}
+				elems = append(elems, zero)
+			}
+		}
+	case *types.Map:
+		for _, elt := range x.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			key, ok := g.elem(kv.Key, u.Key())
+			if !ok {
+				return "", false
+			}
+			value, ok := g.elem(kv.Value, u.Elem())
+			if !ok {
+				return "", false
+			}
+			elems = append(elems, key+": "+value)
+		}
+	default:
+		return "", false
+	}
+	// matchValue tells lists and maps from structs by their literal
+	// syntax, so these use the underlying type, not a name.
+	return g.typeString(t.Underlying()) + "{" + strings.Join(elems, ", ") + "}", true
+}
+
+// elem returns the Go expression for x, an element of type t
+// of a composite literal, which may have its type elided.
+func (g *generator) elem(x ast.Expr, t types.Type) (string, bool) {
+	if lit, ok := x.(*ast.CompositeLit); ok && lit.Type == nil {
+		return g.composite(lit, t)
+	}
+	return g.expr(x)
+}
+
+// zero returns the Go expression for the zero value of t.
+func (g *generator) zero(t types.Type) (string, bool) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false", true
+		case u.Info()&types.IsString != 0:
+			return `""`, true
+		case u.Info()&types.IsNumeric != 0:
+			return "0", true
+		}
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature, *types.Interface:
+		return "nil", true
+	case *types.Struct:
+		var fields []string
+		for i := 0; i < u.NumFields(); i++ {
+			zero, ok := g.zero(u.Field(i).Type())
+			if !ok {
+				return "", false
+			}
+			fields = append(fields, u.Field(i).Name()+": "+zero)
+		}
+		return g.typeString(t) + "{" + strings.Join(fields, ", ") + "}", true
+	case *types.Array:
+		zero, ok := g.zero(u.Elem())
+		if !ok {
+			return "", false
+		}
+		elems := make([]string, u.Len())
+		for i := range elems {
+			elems[i] = zero
+		}
+		return g.typeString(u) + "{" + strings.Join(elems, ", ") + "}", true
+	}
+	return "", false
+}
+
+// typeString returns t as written in the generated program.
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(g.pkg))
+}
+
+// constString returns a Go expression for c.
+func constString(c constant.Value) string {
+	switch c.Kind() {
+	case constant.String:
+		return strconv.Quote(constant.StringVal(c))
+	case constant.Float:
+		f, _ := constant.Float64Val(c)
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	case constant.Complex:
+		re, _ := constant.Float64Val(constant.Real(c))
+		im, _ := constant.Float64Val(constant.Imag(c))
+		return fmt.Sprintf("(%s + %si)", strconv.FormatFloat(re, 'g', -1, 64), strconv.FormatFloat(im, 'g', -1, 64))
+	}
+	return c.ExactString()
+}
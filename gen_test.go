@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenKinds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugo-gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, k := range genKinds {
+		src, err := k.generate()
+		if err != nil {
+			t.Errorf("%s: %v", k.name, err)
+			continue
+		}
+		filename := filepath.Join(dir, k.name+".go")
+		if err := ioutil.WriteFile(filename, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+		bps, err := Parse(filename)
+		if err != nil {
+			t.Errorf("%s: %v", k.name, err)
+			continue
+		}
+		vars := strings.Count(strings.TrimSpace(dedent(k.vars)), "\n") + 1
+		if len(bps) != 1 || len(bps[0].Tests) != vars {
+			t.Errorf("%s: got %v, want a breakpoint with %d tests", k.name, bps, vars)
+		}
+	}
+}
+
+func TestGenTests(t *testing.T) {
+	k := genKind{name: "x", doc: "x", types: `
+		type T struct {
+			A int
+			B []string
+		}
+	`, vars: `
+		n := 3
+		p := &n
+		t := T{B: []string{"x"}}
+		ts := []T{{A: 1}}
+		a := [2]*int{}
+		ch := make(chan int)
+		var z T
+	`}
+	src, err := k.generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`// (value) n == 3`,
+		`// (value) p == &3`,
+		`// (value) t == T{A: 0, B: []string{"x"}}`,
+		`// (value) ts == []T{T{A: 1, B: nil}}`,
+		`// (value) a == [2]*int{nil, nil}`,
+		"// (any) print ch\n\t// " + addressRe,
+		`// (value) z == T{A: 0, B: nil}`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated program lacks %q:\n%s", want, src)
+		}
+	}
+}
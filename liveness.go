@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// livenessTests returns the tests run by -liveness at bps: (any) locals
+// at each BREAKPOINT, with a want that matches anything.
+func livenessTests(bps []Breakpoint) []Breakpoint {
+	var out []Breakpoint
+	for _, bp := range bps {
+		bp.Tests = nil
+		if bp.Kind == "" {
+			bp.Tests = []Test{{Line: bp.Line, Debugger: "any", Command: "locals", Want: []string{anyOutput}}}
+		}
+		out = append(out, bp)
+	}
+	return out
+}
+
+// buildOptimized builds t's source again, with the compiler's default
+// optimizations and inlining, as a target with the same tests.
+func buildOptimized(goTool string, t *Target) (*Target, error) {
+	opt := *t
+	opt.RunDir = t.RunDir + ".opt"
+	opt.Executable = filepath.Join(opt.RunDir, filepath.Base(t.Executable))
+	opt.Optimized = true
+	if err := os.MkdirAll(opt.RunDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := goBuild(goTool, opt.Executable, crossEnv(), nil, t.Source); err != nil {
+		return nil, err
+	}
+	return &opt, nil
+}
+
+// A liveness collects, for -liveness, the locals each debugger shows at
+// each BREAKPOINT in the -N -l and optimized builds of the targets, to
+// score how much of the -N -l view survives optimization.
+type liveness struct {
+	funcs  map[diffKey]string       // function of each breakpoint
+	order  []diffKey                // breakpoints, in order added
+	locals map[livenessKey][]string // locals output lines
+}
+
+type livenessKey struct {
+	bp        diffKey
+	debugger  string
+	optimized bool
+}
+
+func newLiveness() *liveness {
+	return &liveness{
+		funcs:  make(map[diffKey]string),
+		locals: make(map[livenessKey][]string),
+	}
+}
+
+// add notes the BREAKPOINTs of t, an unoptimized target.
+func (lv *liveness) add(t *Target) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, t.Source, nil, 0)
+	if err != nil {
+		return err
+	}
+	tf := fset.File(f.Pos())
+	for _, bp := range t.Breakpoints {
+		if bp.Kind != "" {
+			continue
+		}
+		key := diffKey{bp.Filename, bp.Line}
+		fn, err := enclosingFunc(f, tf.LineStart(bp.Line))
+		if err != nil {
+			fn = "(no function)"
+		}
+		lv.funcs[key] = fn
+		lv.order = append(lv.order, key)
+	}
+	return nil
+}
+
+// record notes res, a PASS result from debugger for the locals at one of
+// t's breakpoints.
+func (lv *liveness) record(t *Target, debugger string, res TestResult) {
+	key := livenessKey{diffKey{res.File, res.Line}, debugger, t.Optimized}
+	lv.locals[key] = splitLines(res.Have)
+}
+
+// A local's liveness class.
+const (
+	available    = "available"
+	optimizedOut = "optimized out"
+	wrong        = "wrong"
+)
+
+// unavailableRE matches the debuggers' renderings of values that have
+// been optimized out: gdb's "<optimized out>", and lldb's "<variable not
+// available>" and "<no location, value may have been optimized out>".
+var unavailableRE = regexp.MustCompile(`optimized out|not available`)
+
+// addressRE matches addresses, which differ between builds.
+var addressRE = regexp.MustCompile(`0x[0-9a-f]+`)
+
+// classify classifies each local in ref, the locals at a breakpoint in
+// the -N -l build, by how it appears in opt, the locals there in the
+// optimized build. Locals unavailable in ref are left out.
+func classify(ref, opt []string) map[string]string {
+	optValues := localValues(opt)
+	classes := make(map[string]string)
+	for name, want := range localValues(ref) {
+		if unavailableRE.MatchString(want) {
+			continue
+		}
+		have, ok := optValues[name]
+		switch {
+		case !ok || unavailableRE.MatchString(have):
+			classes[name] = optimizedOut
+		case addressRE.ReplaceAllString(have, "0x") != addressRE.ReplaceAllString(want, "0x"):
+			classes[name] = wrong
+		default:
+			classes[name] = available
+		}
+	}
+	return classes
+}
+
+// localValues returns the values of the locals in lines, "name = value"
+// lines as output by (any) locals.
+func localValues(lines []string) map[string]string {
+	values := make(map[string]string)
+	for _, l := range lines {
+		if i := strings.Index(l, " = "); i >= 0 {
+			values[l[:i]] = l[i+len(" = "):]
+		}
+	}
+	return values
+}
+
+// A livenessScore tallies the classes of the locals of one function,
+// as seen by one debugger.
+type livenessScore struct {
+	fn, debugger                     string
+	locals, available, optOut, wrong int
+	unreached                        int // breakpoints not reached in the optimized build
+}
+
+// scores classifies the locals at every breakpoint reached in both
+// builds, and tallies them by function and debugger. If w is not nil,
+// the locals that aren't available are listed there.
+func (lv *liveness) scores(w io.Writer) []*livenessScore {
+	debuggerSet := make(map[string]bool)
+	for key := range lv.locals {
+		debuggerSet[key.debugger] = true
+	}
+	var debuggers []string
+	for d := range debuggerSet {
+		debuggers = append(debuggers, d)
+	}
+	sort.Strings(debuggers)
+
+	byFunc := make(map[[2]string]*livenessScore)
+	for _, bp := range lv.order {
+		fn := lv.funcs[bp]
+		for _, d := range debuggers {
+			ref, ok := lv.locals[livenessKey{bp, d, false}]
+			if !ok {
+				continue
+			}
+			s := byFunc[[2]string{fn, d}]
+			if s == nil {
+				s = &livenessScore{fn: fn, debugger: d}
+				byFunc[[2]string{fn, d}] = s
+			}
+			opt, ok := lv.locals[livenessKey{bp, d, true}]
+			if !ok {
+				s.unreached++
+				continue
+			}
+			classes := classify(ref, opt)
+			var names []string
+			for name := range classes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				s.locals++
+				switch classes[name] {
+				case available:
+					s.available++
+					continue
+				case optimizedOut:
+					s.optOut++
+				case wrong:
+					s.wrong++
+				}
+				if w != nil {
+					fmt.Fprintf(w, "[liveness] %s:%d %s: %s %s\n", bp.file, bp.line, d, name, classes[name])
+				}
+			}
+		}
+	}
+	var scores []*livenessScore
+	for _, s := range byFunc {
+		scores = append(scores, s)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].fn != scores[j].fn {
+			return scores[i].fn < scores[j].fn
+		}
+		return scores[i].debugger < scores[j].debugger
+	})
+	return scores
+}
+
+// report prints the debuggability score of each function, by debugger:
+// the percentage of its locals at its reached breakpoints that are
+// available in the optimized build. With verbose, the locals that
+// aren't are listed first.
+func (lv *liveness) report(w io.Writer, verbose bool) {
+	var details io.Writer
+	if verbose {
+		details = w
+	}
+	scores := lv.scores(details)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "[liveness] FUNCTION\tDEBUGGER\tLOCALS\tAVAILABLE\tOPTIMIZED OUT\tWRONG\tUNREACHED\tSCORE")
+	for _, s := range scores {
+		score := "-"
+		if s.locals > 0 {
+			score = fmt.Sprintf("%.0f%%", 100*float64(s.available)/float64(s.locals))
+		}
+		fmt.Fprintf(tw, "[liveness] %s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", s.fn, s.debugger, s.locals, s.available, s.optOut, s.wrong, s.unreached, score)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	ref := []string{"a = 1", "b = 2", "c = 3", "d = <optimized out>", "p = 0xc000012345", "s = []int len: 2, cap: 2, [1, 2]"}
+	opt := []string{"a = 1", "b = <optimized out>", "c = 4", "d = 4", "p = 0xc000099999"}
+	want := map[string]string{
+		"a": available,
+		"b": optimizedOut,
+		"c": wrong,
+		"p": available,
+		"s": optimizedOut,
+	}
+	if got := classify(ref, opt); !reflect.DeepEqual(got, want) {
+		t.Errorf("classify = %v, want %v", got, want)
+	}
+}
+
+func TestLivenessReport(t *testing.T) {
+	lv := newLiveness()
+	target := &Target{Source: "test/sanity.go", Breakpoints: []Breakpoint{{Filename: "test/sanity.go", Line: 11}}}
+	if err := lv.add(target); err != nil {
+		t.Fatal(err)
+	}
+	if fn := lv.funcs[diffKey{"test/sanity.go", 11}]; fn != "main.main" {
+		t.Errorf("breakpoint in %q, want main.main", fn)
+	}
+
+	opt := *target
+	opt.Optimized = true
+	locals := func(t *Target, debugger, have string) {
+		lv.record(t, debugger, TestResult{Status: "PASS", File: "test/sanity.go", Line: 11, Have: have})
+	}
+	locals(target, "gdb", "a = 1\nb = 2")
+	locals(&opt, "gdb", "a = 1\nb = <optimized out>")
+	locals(target, "lldb", "a = 1\nb = 2")
+
+	var buf bytes.Buffer
+	lv.report(&buf, true)
+	want := `[liveness] test/sanity.go:11 gdb: b optimized out
+[liveness] FUNCTION   DEBUGGER  LOCALS  AVAILABLE  OPTIMIZED OUT  WRONG  UNREACHED  SCORE
+[liveness] main.main  gdb       2       1          1              0      0          50%
+[liveness] main.main  lldb      0       0          0              0      1          -
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLivenessTests(t *testing.T) {
+	bps := []Breakpoint{
+		{Filename: "x.go", Line: 4, Tests: []Test{{Line: 5, Debugger: "any", Command: "print x", Want: []string{"1"}}}},
+		{Filename: "x.go", Line: 9, Kind: "core", Tests: []Test{{Line: 10, Debugger: "any", Command: "print x", Want: []string{"1"}}}},
+		{Filename: "x.go", Line: 12},
+	}
+	want := []Breakpoint{
+		{Filename: "x.go", Line: 4, Tests: []Test{{Line: 4, Debugger: "any", Command: "locals", Want: []string{anyOutput}}}},
+		{Filename: "x.go", Line: 9, Kind: "core"},
+		{Filename: "x.go", Line: 12, Tests: []Test{{Line: 12, Debugger: "any", Command: "locals", Want: []string{anyOutput}}}},
+	}
+	if got := livenessTests(bps); !reflect.DeepEqual(got, want) {
+		t.Errorf("livenessTests = %+v, want %+v", got, want)
+	}
+}
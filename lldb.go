@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"text/template"
@@ -19,106 +21,529 @@ import sys
 
 import lldb
 
-sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
-sock.connect("{{.Sock}}")
+sock = None
+sent = 0
 
-def send_result(status, msg=None, filename=None, lineno=None):
-	res = {"status": status}
+def send(msg):
+	dump = json.dumps(msg) + "\n"
+	enc = dump.encode('ascii')
+	sock.sendall(enc)
+
+def echo(s):
+	# write s to the debugger's stdout, which goes in the transcript
+	if s and not s.endswith("\n"):
+		s += "\n"
+	sys.stdout.write(s)
+	sys.stdout.flush()
+
+def send_result(status, msg=None, filename=None, lineno=None, **fields):
+	global sent
+	# mark each result in the transcript, as transcriptLine does
+	echo("[debugo] %s %s:%d %s" % (status, filename or "", lineno or 0, ("" if msg is None else str(msg)).replace("\n", " ")))
+	res = {"type": "result", "status": status}
+	res.update(fields)
 	if msg is not None:
 		res["msg"] = str(msg)
 	if filename is not None:
 		res["file"] = filename
 	if lineno is not None:
 		res["line"] = lineno
-	dump = json.dumps(res) + "\n"
-	enc = dump.encode('ascii')
-	sock.sendall(enc)
+	send(res)
+	sent += 1
 
-debugger = lldb.SBDebugger.Create()
-debugger.SkipLLDBInitFiles(True)
-debugger.SetAsync(False)  # pause script execution when running lldb commands
+def begin_run(sock_path, run_id):
+	global sock, sent
+	sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+	sock.connect(sock_path)
+	sent = 0
+	send({"type": "hello", "version": {{.Protocol}}, "run": run_id, "debugger": "lldb", "debugger_version": lldb.SBDebugger.GetVersionString()})
 
-target = debugger.CreateTargetWithFileAndArch({{.Executable | printf "%q"}}, lldb.LLDB_ARCH_DEFAULT)
+def send_end():
+	send({"type": "end", "results": sent})
+	sock.close()
 
-if not target:
-	send_result("ERROR", "failed to create target")
-	sys.exit(1)	
+class AbortRun(Exception):
+	pass
 
-bps = {}
-{{range $bp := .Breakpoints}}
-{{if .Tests}}
-filename = {{$bp.Filename | printf "%q"}}
-lineno = {{$bp.Line}}
-bp = target.BreakpointCreateByLocation(filename, lineno)
-if bp.GetNumLocations() != 1:
-	send_result("ERROR", "failed to resolve breakpoint; see golang.org/issue/7070", filename, lineno)
-	sys.exit(1)
-#bp.SetOneShot(True)
-tests = []
-{{range $test := .Tests}}
-{{if eq $test.Debugger "lldb" }}
-tests.append(({{$test.Command | printf "%q"}}, {{$test.Want | joinn | printf "%q"}}, filename, {{$test.Line}}))
-{{end}}
-{{end}}
-bps[bp.GetID()] = (bp, tests)
-{{end}}
-{{end}}
+def abort_run(msg, filename=None, lineno=None):
+	send_result("ERROR", msg, filename, lineno)
+	send_end()
+	raise AbortRun(msg)
+
+` + lldbNormalizePython + `
+def typedef_names(t):
+	# maps and channels are typedefs named map[K]V and chan T of
+	# pointers, possibly under further typedefs of named types
+	names = []
+	while t.IsTypedefType():
+		names.append(t.GetName())
+		t = t.GetTypedefedType()
+	return names
 
-process = target.LaunchSimple(None, None, os.getcwd())
+def dump_value(v, depth=0):
+	if depth > 8:
+		return {"kind": "scalar", "value": "..."}
+	t = v.GetType().GetCanonicalType()
+	name = t.GetName()
+	for n in typedef_names(v.GetType()):
+		if n.startswith("map[") or n.startswith("chan "):
+			name = n
+	flags = t.GetTypeFlags()
+	res = {"type": v.GetTypeName()}
+	if name == "string":
+		n = v.GetChildMemberWithName("len").GetValueAsUnsigned()
+		data = b""
+		if n > 0:
+			err = lldb.SBError()
+			data = process.ReadMemory(v.GetChildMemberWithName("str").GetValueAsUnsigned(), n, err)
+			if not err.Success():
+				raise Exception("reading string: " + str(err))
+		res["kind"] = "string"
+		res["value"] = data.decode("utf-8", "replace")
+	elif name.startswith("[]"):
+		n = v.GetChildMemberWithName("len").GetValueAsUnsigned()
+		arr = v.GetChildMemberWithName("array")
+		if arr.GetValueAsUnsigned() == 0:
+			res["kind"] = "nil"
+			return res
+		res["kind"] = "list"
+		res["children"] = [{"value": dump_value(arr.GetChildAtIndex(i, lldb.eNoDynamicValues, True), depth+1)} for i in range(n)]
+	elif t.IsArrayType():
+		res["kind"] = "list"
+		res["children"] = [{"value": dump_value(v.GetChildAtIndex(i), depth+1)} for i in range(v.GetNumChildren())]
+	elif t.IsPointerType():
+		if v.GetValueAsUnsigned() == 0:
+			res["kind"] = "nil"
+		elif name.startswith("map["):
+			return dump_map(v, res, depth)
+		elif name.startswith("chan "):
+			# lldb has no Go channel formatter
+			res["kind"] = "scalar"
+			res["value"] = v.GetValue()
+		else:
+			res["kind"] = "pointer"
+			res["children"] = [{"value": dump_value(v.Dereference(), depth+1)}]
+	elif flags & lldb.eTypeIsInteger:
+		res["kind"] = "scalar"
+		res["value"] = str(v.GetValueAsSigned() if flags & lldb.eTypeIsSigned else v.GetValueAsUnsigned())
+	elif flags & (lldb.eTypeIsScalar | lldb.eTypeIsFloat):
+		res["kind"] = "scalar"
+		res["value"] = v.GetValue()
+	elif flags & lldb.eTypeIsStructUnion:
+		res["kind"] = "struct"
+		res["children"] = [{"name": v.GetChildAtIndex(i).GetName(), "value": dump_value(v.GetChildAtIndex(i), depth+1)} for i in range(v.GetNumChildren())]
+	else:
+		res["kind"] = "scalar"
+		res["value"] = v.GetValue() or v.GetSummary() or ""
+	return res
 
-if not process:
-	send_result("ERROR", "failed to launch process")
-	sys.exit(1)	
+class Unsupported(Exception):
+	pass
 
-while True:
-	state = process.GetState()
-	if state == lldb.eStateExited:
-		# process has exited; we're done
-		sys.exit(0)
+def dump_map(v, res, depth):
+	# walk the buckets of a runtime.hmap, as runtime-gdb.py does for gdb;
+	# the swiss tables of Go 1.24 and later have none
+	h = v.Dereference()
+	buckets = h.GetChildMemberWithName("buckets")
+	if not buckets.IsValid():
+		raise Unsupported("maps of this Go version are not supported by lldb")
+	B = h.GetChildMemberWithName("B").GetValueAsUnsigned()
+	oldbuckets = h.GetChildMemberWithName("oldbuckets").GetValueAsUnsigned()
+	btype = buckets.GetType().GetPointeeType()
+	size = btype.GetByteSize()
+	target = v.GetTarget()
 
-	if state != lldb.eStateStopped:
-		send_result("ERROR", "unexpected process state: " + str(state))
-		sys.exit(1)
+	def bucket(base, i):
+		return target.CreateValueFromAddress("bucket", lldb.SBAddress(base + i * size, target), btype)
 
-	# find the current breakpoint
-	bp_id = None
-	for t in process:
-		if t.GetStopReason() == lldb.eStopReasonBreakpoint:
-			bp_id = t.GetStopReasonDataAtIndex(0)
-			break
+	def evacuated(b):
+		top = b.GetChildMemberWithName("tophash").GetChildAtIndex(0).GetValueAsUnsigned()
+		return 1 < top < 5
 
-	if bp_id is None:
-		send_result("ERROR", "stopped but not on a breakpoint")
-		sys.exit(1)
+	res["kind"] = "map"
+	res["children"] = []
+	for i in range(1 << B):
+		b = bucket(buckets.GetValueAsUnsigned(), i)
+		if oldbuckets != 0:
+			# entries not yet moved by a growing map are in its old buckets
+			old = bucket(oldbuckets, i & ((1 << (B - 1)) - 1))
+			if not evacuated(old):
+				if i >= 1 << (B - 1):
+					continue
+				b = old
+		while True:
+			tophash = b.GetChildMemberWithName("tophash")
+			keys = b.GetChildMemberWithName("keys")
+			values = b.GetChildMemberWithName("values")
+			for j in range(tophash.GetNumChildren()):
+				if tophash.GetChildAtIndex(j).GetValueAsUnsigned() < 5:
+					continue
+				res["children"].append({
+					"key": dump_value(keys.GetChildAtIndex(j), depth+1),
+					"value": dump_value(values.GetChildAtIndex(j), depth+1),
+				})
+			overflow = b.GetChildMemberWithName("overflow")
+			if overflow.GetValueAsUnsigned() == 0:
+				break
+			b = overflow.Dereference()
+	return res
+
+def test_value(frame, expr, filename, lineno):
+	send_result("RUNNING", expr, filename, lineno)
+	v = frame.FindVariable(expr)
+	if not v.IsValid():
+		v = frame.GetValueForVariablePath(expr)
+	if not v.IsValid() or v.GetError().Fail():
+		send_result("FAIL", "failed to evaluate '" + expr + "': " + str(v.GetError()), filename, lineno)
+		return
+	try:
+		value = dump_value(v)
+	except Unsupported as e:
+		send_result("SKIP", str(e), filename, lineno)
+		return
+	except Exception as e:
+		send_result("FAIL", "failed to evaluate '" + expr + "': " + str(e), filename, lineno)
+		return
+	send_result("VALUE", None, filename, lineno, value=value)
+
+debugger = lldb.SBDebugger.Create()
+debugger.SkipLLDBInitFiles(True)
+debugger.SetAsync(False)  # pause script execution when running lldb commands
 
-	bp_tests = bps.get(bp_id)
-	if bp_tests is None:
-		send_result("ERROR", "stopped at an unrecognized breakpoint")
-		sys.exit(1)
+process = None
 
-	# Run the commands, check the results
-	bp, tests = bp_tests
+def run_tests(tests):
+	# run the tests in the selected frame, checking the results
 	for test in tests:
-		cmd, want, filename, lineno = test
+		kind, cmd, want, filename, lineno, norm = test
+		if kind == "value":
+			test_value(process.GetSelectedThread().GetSelectedFrame(), cmd, filename, lineno)
+			continue
 
 		send_result("RUNNING", cmd, filename, lineno)
 		ret = lldb.SBCommandReturnObject()
 		debugger.GetCommandInterpreter().HandleCommand(cmd, ret)
+		echo(ret.GetOutput())
+		echo(ret.GetError())
 		if not ret.Succeeded():
 			send_result("ERROR", "command " + cmd + " failed: " + ret.GetError().strip(), filename, lineno)
 			continue
 
 		out = ret.GetOutput()
+		if norm == "history" and not normalize_history:
+			norm = ""
+		out = normalize(norm, out)
 		match = re.match("^" + want + "$", out)
 		if match is None:
-			msg = "want regex {want} have {out}".format(**locals())
-			send_result("FAIL", msg, filename, lineno)
+			send_result("FAIL", "output did not match", filename, lineno, want=want.split("\n"), have=out)
 		else:
-			send_result("PASS", None, filename, lineno)
+			send_result("PASS", None, filename, lineno, have=out)
+
+def run_target(source, executable, optimized, bp_specs, crash, args, env, stdin, stdout, stderr):
+	global process
+	target = debugger.CreateTargetWithFileAndArch(executable, lldb.LLDB_ARCH_DEFAULT)
+
+	if not target:
+		abort_run("failed to create target")
+
+	bps = {}
+	for filename, lineno, tests in bp_specs:
+		bp = target.BreakpointCreateByLocation(filename, lineno)
+		if optimized and bp.GetNumLocations() == 0:
+			# the line was optimized away, so its tests go unreached
+			target.BreakpointDelete(bp.GetID())
+			continue
+		if not optimized and bp.GetNumLocations() != 1:
+			abort_run("failed to resolve breakpoint; see golang.org/issue/7070", filename, lineno)
+		#bp.SetOneShot(True)
+		bps[bp.GetID()] = (bp, tests)
 
-	process.Continue()
+	# catch the panic for a PANIC marker; lldb stops
+	# for signals such as SIGSEGV by default
+	panic_id = None
+	if crash is not None and crash[0] == "PANIC":
+		bp = target.BreakpointCreateByName("runtime.gopanic")
+		if bp.GetNumLocations() == 0:
+			abort_run("failed to resolve breakpoint on runtime.gopanic", crash[2][0], crash[2][1])
+		bp.SetOneShot(True)
+		panic_id = bp.GetID()
+
+	# launch with the program's arguments, stdin, and
+	# additions to our environment
+	info = lldb.SBLaunchInfo(args)
+	environ = dict(os.environ)
+	for kv in env:
+		k, _, v = kv.partition("=")
+		environ[k] = v
+	info.SetEnvironmentEntries([k + "=" + v for k, v in environ.items()], False)
+	info.SetWorkingDirectory(os.getcwd())
+	if stdin:
+		info.AddOpenFileAction(0, stdin, True, False)
+	info.AddOpenFileAction(1, stdout, False, True)
+	info.AddOpenFileAction(2, stderr, False, True)
+	error = lldb.SBError()
+	process = target.Launch(info, error)
+
+	if not process or error.Fail():
+		abort_run("failed to launch process: " + str(error))
+
+	while True:
+		state = process.GetState()
+		if state == lldb.eStateExited:
+			# process has exited; we're done
+			send_result("EXIT", None, source, exit_code=process.GetExitStatus())
+			return
+
+		if state != lldb.eStateStopped:
+			abort_run("unexpected process state: " + str(state))
+
+		# find the current breakpoint, or the signal for a SIGNAL marker
+		bp_id = None
+		signal = None
+		for t in process:
+			if t.GetStopReason() == lldb.eStopReasonBreakpoint:
+				bp_id = t.GetStopReasonDataAtIndex(0)
+				process.SetSelectedThread(t)
+				break
+			if t.GetStopReason() == lldb.eStopReasonSignal:
+				signal = process.GetUnixSignals().GetSignalAsCString(t.GetStopReasonDataAtIndex(0))
+				break
+
+		if crash is not None and (bp_id is not None and bp_id == panic_id or crash[0] == "SIGNAL" and signal == crash[1]):
+			# run the tests in the frame that panicked or faulted, once,
+			# then let the program carry on dying
+			run_markers([crash[2]], crash[0])
+			crash = None
+			process.Continue()
+			continue
+
+		if bp_id is None:
+			if signal is not None:
+				abort_run("stopped by signal " + signal)
+			abort_run("stopped but not on a breakpoint")
+
+		bp_tests = bps.get(bp_id)
+		if bp_tests is None:
+			abort_run("stopped at an unrecognized breakpoint")
+
+		bp, tests = bp_tests
+		run_tests(tests)
+		if optimized:
+			# a line may have several locations; test at the first reached
+			bp.SetEnabled(False)
+		process.Continue()
+
+def audit_target(executable, bp_specs):
+	# report the addresses lldb resolves each breakpoint to
+	target = debugger.CreateTarget(executable)
+	if not target:
+		abort_run("failed to create target")
+	for filename, lineno, tests in bp_specs:
+		bp = target.BreakpointCreateByLocation(filename, lineno)
+		addrs = ["0x%x" % bp.GetLocationAtIndex(i).GetAddress().GetFileAddress() for i in range(bp.GetNumLocations())]
+		send_result("LOCATIONS", None, filename, lineno, addresses=addrs)
+		target.BreakpointDelete(bp.GetID())
+
+def run_core(executable, core, bp_specs):
+	global process
+	target = debugger.CreateTarget(executable)
+	if not target:
+		abort_run("failed to create target for core")
+	process = target.LoadCore(core)
+	if not process.IsValid():
+		abort_run("failed to load core " + core)
+	run_markers(bp_specs, "CORE")
+
+def run_attach(executable, pid, bp_specs):
+	global process
+	target = debugger.CreateTarget(executable)
+	if not target:
+		abort_run("failed to create target for attach")
+	error = lldb.SBError()
+	process = target.AttachToProcessWithID(debugger.GetListener(), pid, error)
+	if error.Fail() or not process.IsValid():
+		abort_run("failed to attach to process " + str(pid) + ": " + str(error))
+	run_markers(bp_specs, "ATTACH")
+	process.Detach()
+	process = None
+
+def run_markers(bp_specs, marker):
+	# run the tests of each marker in the frame at the marker
+	for filename, lineno, tests in bp_specs:
+		frame = find_frame(filename, lineno)
+		if frame is None:
+			send_result("ERROR", "no frame at the " + marker + " marker", filename, lineno)
+			continue
+		process.SetSelectedThread(frame.GetThread())
+		frame.GetThread().SetSelectedFrame(frame.GetFrameID())
+		run_tests(tests)
+
+def find_frame(filename, lineno):
+	# find the frame at filename:lineno in any thread
+	for t in process:
+		for f in t:
+			le = f.GetLineEntry()
+			if le.GetLine() == lineno and le.GetFileSpec().GetFilename() == os.path.basename(filename):
+				return f
+	return None
+
+# Each target is (source, executable, socket, run ID, optimized, breakpoints,
+# crash, launch, core, attach), and each breakpoint is (filename, line, tests).
+# An optimized target, for -liveness, may have lines with no location or
+# several.
+# The crash is None, or ("PANIC" or "SIGNAL", signal name, breakpoint) for
+# the PANIC or SIGNAL marker, whose line is where the program should stop.
+# The launch options are (args, env, stdin, stdout, stderr). The core is None, or
+# (executable, core file, breakpoints) for the CORE markers, and
+# attach is None, or (executable, pid, breakpoints) for ATTACH.
+# When auditing, the breakpoints are all the BREAKPOINT lines, which are
+# resolved rather than run. Value history prefixes are only normalized
+# if normalize_history, as set by -normalize.
+audit = {{if .Audit}}True{{else}}False{{end}}
+normalize_history = {{if .Normalize}}True{{else}}False{{end}}
+targets = []
+{{range $t := .Targets}}
+specs = {"": [], "core": [], "attach": []}
+crash = None
+{{range $bp := $t.Breakpoints}}
+{{if or .Tests $.Audit}}
+filename = {{$bp.Filename | printf "%q"}}
+tests = []
+{{range $test := .Tests}}
+{{if runs $test}}
+tests.append(("cmd", {{command $test | printf "%q"}}, {{$test.Want | joinn | printf "%q"}}, filename, {{$test.Line}}, {{$test.Normalization | printf "%q"}}))
+{{else if eq $test.Debugger "value" }}
+tests.append(("value", {{$test.ValueRoot | printf "%q"}}, None, filename, {{$test.Line}}, ""))
+{{end}}
+{{end}}
+{{if or (eq .Kind "panic") (eq .Kind "signal")}}
+crash = ({{$bp.Kind | upper | printf "%q"}}, {{$bp.Signal | printf "%q"}}, (filename, {{$bp.StopLine}}, tests))
+{{else}}
+specs[{{$bp.Kind | printf "%q"}}].append((filename, {{$bp.Line}}, tests))
+{{end}}
+{{end}}
+{{end}}
+core = None
+{{if $t.Core}}
+core = ({{$t.CoreExecutable | printf "%q"}}, {{$t.Core | printf "%q"}}, specs["core"])
+{{end}}
+attach = None
+{{if $t.AttachPid}}
+attach = ({{$t.AttachExecutable | printf "%q"}}, {{$t.AttachPid}}, specs["attach"])
+{{end}}
+launch = (json.loads({{json $t.Args | printf "%q"}}) or [], json.loads({{json $t.Env | printf "%q"}}) or [], {{$t.Stdin | printf "%q"}}, {{output $t "stdout" | printf "%q"}}, {{output $t "stderr" | printf "%q"}})
+targets.append(({{$t.Source | printf "%q"}}, {{$t.Executable | printf "%q"}}, {{$t.Sock | printf "%q"}}, {{$t.RunID | printf "%q"}}, {{if $t.Optimized}}True{{else}}False{{end}}, specs[""], crash, launch, core, attach))
+{{end}}
+
+def cleanup():
+	global process
+	if process:
+		process.Kill()
+		process = None
+	for t in list(debugger):
+		debugger.DeleteTarget(t)
+
+failed = False
+for source, executable, sock_path, run_id, optimized, bp_specs, crash, launch, core, attach in targets:
+	begin_run(sock_path, run_id)
+	try:
+		if audit:
+			audit_target(executable, bp_specs)
+		else:
+			run_target(source, executable, optimized, bp_specs, crash, *launch)
+			cleanup()
+			if core is not None:
+				run_core(*core)
+				cleanup()
+			if attach is not None:
+				run_attach(*attach)
+		send_end()
+	except AbortRun:
+		failed = True
+	cleanup()
+
+sys.exit(1 if failed else 0)
+`
+
+// lldbNormalizePython is the output normalization of the lldb script,
+// which normalize.go mirrors for the lldb REPL of lldb-dap.
+// TestNormalizePython checks that the two agree.
+const lldbNormalizePython = `
+history_re = re.compile(r"^(\(.*?\) )?\$[0-9]+ = ")
+
+def join_lines(lines):
+	# join a multi-line composite value into a single line
+	out = ""
+	for l in lines:
+		l = l.strip()
+		if not l:
+			continue
+		if out.endswith(","):
+			out += " "
+		elif out and not out.endswith(("{", ", ")) and not l.startswith("}"):
+			out += ", "
+		out += l
+	return out
+
+def normalize(norm, out):
+	if norm == "history":
+		return history_re.sub(lambda m: (m.group(1) or "") + "$N = ", out, count=1)
+	if norm == "print":
+		return normalize_print(out)
+	if norm == "locals":
+		return normalize_locals(out)
+	if norm == "bt":
+		return normalize_bt(out)
+	return out
+
+var_re = re.compile(r"^\(.*?\) (\S+ = )?")
+child_type_re = re.compile(r"^\(.*?\) ")
+
+def normalize_print(out):
+	lines = out.splitlines()
+	if not lines:
+		return ""
+	lines[0] = var_re.sub("", history_re.sub("", lines[0], count=1), count=1)
+	return join_lines([lines[0]] + [child_type_re.sub("", l.strip(), count=1) for l in lines[1:]])
+
+def normalize_locals(out):
+	entries = []
+	for l in out.splitlines():
+		if not l.strip():
+			continue
+		if entries and (l[0].isspace() or l.startswith("}")):
+			entries[-1].append(l)
+		else:
+			entries.append([l])
+	locals = []
+	for e in entries:
+		name = var_re.match(e[0])
+		name = name.group(1) if name and name.group(1) else ""
+		locals.append(name + normalize_print("\n".join(e)))
+	return "\n".join(sorted(locals))
+
+lldb_frame_re = re.compile(r"frame #([0-9]+): (?:0x[0-9a-f]+ )?(?:\S+?\x60)?(\S+?)(?:\(.*\))?(?: at ([^:\s]+):([0-9]+)(?::[0-9]+)?)?$")
+
+def normalize_bt(out):
+	frames = []
+	for l in out.splitlines():
+		m = lldb_frame_re.search(l)
+		if m is None:
+			continue
+		frame = "#" + m.group(1) + " " + m.group(2)
+		if m.group(3):
+			frame += " at " + os.path.basename(m.group(3)) + ":" + m.group(4)
+		frames.append(frame)
+	return "\n".join(frames)
 `
 
+// lldbPortable translates portable (any) commands into lldb commands.
+var lldbPortable = map[string]string{
+	"print":  "frame variable %s",
+	"locals": "frame variable --no-args",
+	"bt":     "bt",
+}
+
 // Lldb is all lldb-related context.
 type Lldb struct {
 	Path      string // path to lldb
@@ -134,12 +559,6 @@ func (l *Lldb) Init() error {
 	}
 	l.Path = path
 
-	python, err := exec.LookPath("python")
-	if err != nil {
-		return err
-	}
-	l.Python = python
-
 	pymodBuf := new(bytes.Buffer)
 	cmd := exec.Command(path, "--python-path")
 	cmd.Stdout = pymodBuf
@@ -152,31 +571,101 @@ func (l *Lldb) Init() error {
 	}
 	l.PythonMod = strings.TrimSpace(pymodBuf.String())
 
-	funcMap := template.FuncMap{
-		"joinn": func(v interface{}) (string, error) {
-			slice, ok := v.([]string)
-			if !ok {
-				return "", fmt.Errorf("expected []string, got %v (%T)", v, v)
-			}
-			return strings.Join(slice, "\n"), nil
-		},
+	python, err := l.findPython()
+	if err != nil {
+		return err
 	}
+	l.Python = python
 
-	l.Template = template.Must(template.New("script").Funcs(funcMap).Parse(lldbScriptTemplate))
+	l.Template = newScriptTemplate(l, lldbScriptTemplate)
 
 	// TODO: Check lldb version
 	return nil
 }
 
-func (l *Lldb) Run(executable string, scriptPath string) error {
+// findPython returns the Python interpreter to run the script with: the
+// one given by -python, or else the first that can import lldb's module
+// of the one lldb embeds, python3 and python.
+func (l *Lldb) findPython() (string, error) {
+	var candidates []string
+	if *pythonFlag != "" {
+		candidates = []string{*pythonFlag}
+	} else {
+		cmd := exec.Command(l.Path, "--batch", "--no-lldbinit", "-o", lldbPythonQuery)
+		if *debug {
+			fmt.Println("Running", cmd)
+		}
+		out, _ := cmd.Output()
+		executable, version := parseLldbPython(string(out))
+		if executable != "" {
+			candidates = append(candidates, executable)
+		}
+		if version != "" {
+			candidates = append(candidates, "python"+version)
+		}
+		candidates = append(candidates, "python3", "python")
+	}
+
+	var problems []string
+	for _, c := range candidates {
+		python, err := exec.LookPath(c)
+		if err == nil {
+			err = l.checkPython(python)
+		}
+		if err == nil {
+			return python, nil
+		}
+		problems = append(problems, fmt.Sprintf("%s: %v", c, err))
+	}
+	return "", fmt.Errorf("no Python can import lldb's module from %s (%s)", l.PythonMod, strings.Join(problems, "; "))
+}
+
+// lldbPythonQuery is an lldb command printing the path and version of
+// lldb's embedded Python, as parsed by parseLldbPython.
+const lldbPythonQuery = `script import sys; print("executable=" + sys.executable); print("version=%d.%d" % sys.version_info[:2])`
+
+// parseLldbPython parses the output of lldbPythonQuery. The executable
+// is only that of a Python, not of lldb itself.
+func parseLldbPython(out string) (executable, version string) {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "executable="):
+			executable = strings.TrimPrefix(line, "executable=")
+			if !strings.HasPrefix(filepath.Base(executable), "python") {
+				executable = ""
+			}
+		case strings.HasPrefix(line, "version="):
+			version = strings.TrimPrefix(line, "version=")
+		}
+	}
+	return executable, version
+}
+
+// checkPython checks that python can import lldb's module.
+func (l *Lldb) checkPython(python string) error {
+	cmd := exec.Command(python, "-c", "import lldb")
+	cmd.Env = append(os.Environ(), "PYTHONPATH="+l.PythonMod+":"+os.Getenv("PYTHONPATH"))
+	output := new(bytes.Buffer)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if *debug {
+		fmt.Println("Running", cmd)
+	}
+	if err := cmd.Run(); err != nil {
+		// Such as "ModuleNotFoundError: No module named '_lldb'".
+		return fmt.Errorf("%v: %s", err, lastLine(output.String()))
+	}
+	return nil
+}
+
+func (l *Lldb) Run(executable string, scriptPath string, stdout, stderr io.Writer) error {
 	cmd := exec.Command(l.Python, scriptPath)
-	// TODO: Preserve environ(?)
-	// env := os.Environ()
-	// env = append()
-	cmd.Env = []string{"PYTHONPATH=" + l.PythonMod + ":" + os.Getenv("PYTHONPATH")}
+	// Preserve the environment, which the programs inherit.
+	cmd.Env = append(os.Environ(), "PYTHONPATH="+l.PythonMod+":"+os.Getenv("PYTHONPATH"))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	if *debug {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
 		fmt.Println("Running", cmd)
 	}
 	err := cmd.Run()
@@ -188,11 +677,15 @@ func (l *Lldb) Run(executable string, scriptPath string) error {
 		if ws, ok := exitErr.ProcessState.Sys().(syscall.WaitStatus); ok && ws == 0x6 {
 			fmt.Printf("Failed to import Python lldb module using Python executable %v.\n", l.Python)
 			fmt.Println("This is likely due to not using the system-provided Python, usually at /usr/bin/python.")
-			fmt.Println("Try adjusting your PATH or virtualenv.")
+			fmt.Println("Try adjusting your PATH or virtualenv, or use -python.")
 		}
 	}
 	return err
 }
 
+func (l *Lldb) Translate(verb, arg string) (string, error) {
+	return translate(lldbPortable, verb, arg)
+}
+
 func (l *Lldb) ScriptTemplate() *template.Template { return l.Template }
 func (l *Lldb) Name() string                       { return "lldb" }
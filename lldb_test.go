@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLldbPython(t *testing.T) {
+	for _, tt := range []struct {
+		out, executable, version string
+	}{
+		{"(lldb) script import sys; ...\nexecutable=/usr/bin/python3.11\nversion=3.11\n", "/usr/bin/python3.11", "3.11"},
+		{"(lldb) script import sys; ...\nexecutable=/usr/bin/lldb\nversion=3.9\n", "", "3.9"},
+		{"error: there is no embedded script interpreter in this mode.\n", "", ""},
+	} {
+		executable, version := parseLldbPython(tt.out)
+		if executable != tt.executable || version != tt.version {
+			t.Errorf("parseLldbPython(%q) = %q, %q, want %q, %q", tt.out, executable, version, tt.executable, tt.version)
+		}
+	}
+}
+
+func TestCheckPython(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3")
+	}
+	dir, err := ioutil.TempDir("", "debugo-python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := &Lldb{PythonMod: dir}
+	if err := l.checkPython(python); err == nil || !strings.Contains(err.Error(), "lldb") {
+		t.Errorf("checkPython without the module = %v, want an error naming lldb", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "lldb.py"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.checkPython(python); err != nil {
+		t.Errorf("checkPython with the module = %v", err)
+	}
+}
+
+// fakeLldbModule stands in for lldb's Python module, enough to run the
+// lldb script's run_target. lldb.json configures, by executable, the
+// number of locations of each line and the output of every command.
+const fakeLldbModule = `
+import json
+import os
+
+config = json.load(open(os.path.join(os.path.dirname(__file__), "lldb.json")))
+
+LLDB_ARCH_DEFAULT = None
+eStateStopped, eStateExited = 1, 2
+eStopReasonBreakpoint, eStopReasonSignal = 1, 2
+
+class SBError:
+	def Fail(self):
+		return False
+
+class SBLaunchInfo:
+	def __init__(self, args):
+		pass
+	def SetEnvironmentEntries(self, env, append):
+		pass
+	def SetWorkingDirectory(self, dir):
+		pass
+	def AddOpenFileAction(self, fd, path, read, write):
+		pass
+
+class SBCommandReturnObject:
+	def Succeeded(self):
+		return True
+	def GetOutput(self):
+		return self.output
+	def GetError(self):
+		return ""
+
+class Interpreter:
+	def __init__(self, debugger):
+		self.debugger = debugger
+	def HandleCommand(self, cmd, ret):
+		ret.output = self.debugger.config["output"]
+
+class Breakpoint:
+	def __init__(self, id, locations):
+		self.id, self.locations, self.enabled = id, locations, True
+	def GetID(self):
+		return self.id
+	def GetNumLocations(self):
+		return self.locations
+	def SetEnabled(self, enabled):
+		self.enabled = enabled
+
+class Thread:
+	def __init__(self, bp_id):
+		self.bp_id = bp_id
+	def GetStopReason(self):
+		return eStopReasonBreakpoint
+	def GetStopReasonDataAtIndex(self, i):
+		return self.bp_id
+
+class Process:
+	def __init__(self, target):
+		self.target = target
+		# stop at each location of each breakpoint, in order
+		self.stops = [bp for bp in target.bps.values() for i in range(bp.locations)]
+		self.next_stop()
+	def next_stop(self):
+		while self.stops and not self.stops[0].enabled:
+			self.stops.pop(0)
+	def GetState(self):
+		return eStateStopped if self.stops else eStateExited
+	def GetExitStatus(self):
+		return 0
+	def __iter__(self):
+		return iter([Thread(self.stops[0].id)])
+	def SetSelectedThread(self, t):
+		pass
+	def Continue(self):
+		self.stops.pop(0)
+		self.next_stop()
+	def Kill(self):
+		pass
+
+class Target:
+	def __init__(self, config):
+		self.config, self.bps = config, {}
+	def __bool__(self):
+		return True
+	def BreakpointCreateByLocation(self, filename, line):
+		bp = Breakpoint(len(self.bps) + 1, self.config["locations"].get(str(line), 1))
+		self.bps[bp.id] = bp
+		return bp
+	def BreakpointDelete(self, id):
+		del self.bps[id]
+	def Launch(self, info, error):
+		return Process(self)
+
+class SBDebugger:
+	@staticmethod
+	def Create():
+		return SBDebugger()
+	@staticmethod
+	def GetVersionString():
+		return "fake"
+	def __init__(self):
+		self.targets = []
+	def SkipLLDBInitFiles(self, skip):
+		pass
+	def SetAsync(self, async_):
+		pass
+	def CreateTargetWithFileAndArch(self, executable, arch):
+		self.config = config[executable]
+		self.targets.append(Target(self.config))
+		return self.targets[-1]
+	def DeleteTarget(self, t):
+		self.targets.remove(t)
+	def __iter__(self):
+		return iter(self.targets)
+	def GetCommandInterpreter(self):
+		return Interpreter(self)
+`
+
+// TestLldbLivenessOptimized checks that the lldb script classifies the
+// locals of an optimized target in which one breakpoint's line has two
+// locations and another's has none.
+func TestLldbLivenessOptimized(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "x.go")
+	if err := ioutil.WriteFile(source, []byte("package main\n\nfunc main() {\n\ta, b := 1, 2\n\t_ = a\n\t_ = b\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bps := livenessTests([]Breakpoint{{Filename: source, Line: 5}, {Filename: source, Line: 6}})
+	ref := &Target{Source: source, RunDir: filepath.Join(dir, "x"), Executable: filepath.Join(dir, "x", "x"), Breakpoints: bps}
+	opt := *ref
+	opt.RunDir += ".opt"
+	opt.Executable = filepath.Join(opt.RunDir, "x")
+	opt.Optimized = true
+	for _, t0 := range []*Target{ref, &opt} {
+		if err := os.MkdirAll(t0.RunDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mod := filepath.Join(dir, "mod")
+	if err := os.Mkdir(mod, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := `{
+		"` + ref.Executable + `": {"locations": {}, "output": "a = 1\nb = 2\n"},
+		"` + opt.Executable + `": {"locations": {"5": 2, "6": 0}, "output": "a = 1\nb = <variable not available>\n"}
+	}`
+	if err := ioutil.WriteFile(filepath.Join(mod, "lldb.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mod, "lldb.py"), []byte(fakeLldbModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Lldb{Python: python, PythonMod: mod}
+	l.Template = newScriptTemplate(l, lldbScriptTemplate)
+	r := &runner{tempDir: dir, liveness: newLiveness()}
+	if err := r.liveness.add(ref); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.run(l, []*Target{ref, &opt}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The script marks its commands in the transcript as transcriptLine does.
+	transcript, err := ioutil.ReadFile(filepath.Join(ref.RunDir, "transcript.lldb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := transcriptLine(TestResult{Status: "RUNNING", File: source, Line: 5, Msg: "frame variable --no-args"})
+	if !strings.Contains(string(transcript), "\n"+running+"\na = 1\n") {
+		t.Errorf("transcript doesn't have %q and the output:\n%s", running, transcript)
+	}
+
+	var buf bytes.Buffer
+	r.liveness.report(&buf, false)
+	want := "[liveness] main.main  lldb      2       1          1              0      1          50%\n"
+	if got := buf.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant it to end:\n%s", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CORE and ATTACH markers are tested using a variant of the test program,
+// built from a copy of the source in which the marker calls a helper,
+// such as debugoCore. The helper leaves the marker's frame on the stack
+// of a thread where the debugger can find it.
+
+// Markers returns t's markers of the given kind that have tests.
+func (t *Target) Markers(kind string) []Breakpoint {
+	var bps []Breakpoint
+	for _, bp := range t.Breakpoints {
+		if bp.Kind == kind && len(bp.Tests) > 0 {
+			bps = append(bps, bp)
+		}
+	}
+	return bps
+}
+
+// Crash returns t's PANIC or SIGNAL marker, if it has one with tests.
+// Unlike CORE and ATTACH markers, these are tested in the ordinary run
+// of the program, which the debugger stops when it panics or faults.
+func (t *Target) Crash() *Breakpoint {
+	for i, bp := range t.Breakpoints {
+		if (bp.Kind == "panic" || bp.Kind == "signal") && len(bp.Tests) > 0 {
+			return &t.Breakpoints[i]
+		}
+	}
+	return nil
+}
+
+// findMarker returns t's marker of the given kind,
+// or nil if it has none. There may be at most one.
+func findMarker(t *Target, kind string) (*Breakpoint, error) {
+	var marker *Breakpoint
+	for i, bp := range t.Breakpoints {
+		if bp.Kind != kind {
+			continue
+		}
+		if marker != nil {
+			return nil, fmt.Errorf("%s:%d only one %s marker is allowed per program", bp.Filename, bp.Line, strings.ToUpper(kind))
+		}
+		marker = &t.Breakpoints[i]
+	}
+	return marker, nil
+}
+
+// buildVariant builds the variant of t in which marker calls the helper
+// function call, defined in helpers, which map file names to sources.
+// It returns the executable, in its own directory under t.RunDir.
+func buildVariant(goTool string, t *Target, marker *Breakpoint, call string, helpers map[string]string) (string, error) {
+	src, err := ioutil.ReadFile(t.Source)
+	if err != nil {
+		return "", err
+	}
+	src, err = insertCall(src, marker.Line, "// "+strings.ToUpper(marker.Kind), call)
+	if err != nil {
+		return "", fmt.Errorf("%s:%d %v", marker.Filename, marker.Line, err)
+	}
+
+	dir := filepath.Join(t.RunDir, marker.Kind)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	source := filepath.Join(dir, filepath.Base(t.Source))
+	if err := ioutil.WriteFile(source, src, 0644); err != nil {
+		return "", err
+	}
+	sources := []string{source}
+	for name, text := range helpers {
+		helper := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(helper, []byte(text), 0644); err != nil {
+			return "", err
+		}
+		sources = append(sources, helper)
+	}
+	executable := filepath.Join(dir, filepath.Base(t.RunDir))
+	return executable, build(goTool, executable, sources...)
+}
+
+// insertCall rewrites the marker comment on line lineno of src
+// into a call to call, without changing any line numbers.
+func insertCall(src []byte, lineno int, marker, call string) ([]byte, error) {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	if lineno < 1 || lineno > len(lines) {
+		return nil, fmt.Errorf("no line %d", lineno)
+	}
+	line := lines[lineno-1]
+	i := bytes.Index(line, []byte(marker))
+	if i < 0 {
+		return nil, fmt.Errorf("%s marker not found", marker)
+	}
+	lines[lineno-1] = append(append(line[:i:i], call+"() "...), line[i:]...)
+	return bytes.Join(lines, nil), nil
+}
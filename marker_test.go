@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestInsertCall(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\t// CORE\n\t// (any) bt\n}\n"
+	want := "package main\n\nfunc main() {\n\tdebugoCore() // CORE\n\t// (any) bt\n}\n"
+	have, err := insertCall([]byte(src), 4, "// CORE", "debugoCore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != want {
+		t.Errorf("insertCall:\n%s\nwant:\n%s", have, want)
+	}
+	if _, err := insertCall([]byte(src), 5, "// CORE", "debugoCore"); err == nil {
+		t.Errorf("insertCall on a line without a marker succeeded")
+	}
+}
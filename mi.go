@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An miRecord is a single line of GDB/MI output.
+// See https://sourceware.org/gdb/current/onlinedocs/gdb.html/GDB_002fMI-Output-Syntax.html.
+type miRecord struct {
+	Token   string
+	Kind    byte   // '^' result, '*' exec async, '+' status async, '=' notify, '~' console, '@' target, '&' log
+	Class   string // "done", "error", "stopped", ...; empty for stream records
+	Text    string // decoded text of stream records
+	Results map[string]interface{}
+}
+
+// Values in miRecord.Results are strings, tuples (map[string]interface{})
+// and lists ([]interface{}). The keys of lists of results are dropped.
+
+// String returns the string result named key, or "".
+func (r miRecord) String(key string) string {
+	s, _ := r.Results[key].(string)
+	return s
+}
+
+// parseMI parses a line of GDB/MI output.
+// The "(gdb)" prompt is reported as io.EOF.
+func parseMI(line string) (miRecord, error) {
+	var r miRecord
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "(gdb)" {
+		return r, io.EOF
+	}
+	i := 0
+	for i < len(line) && '0' <= line[i] && line[i] <= '9' {
+		i++
+	}
+	r.Token, line = line[:i], line[i:]
+	if line == "" {
+		return r, fmt.Errorf("empty MI record")
+	}
+	r.Kind, line = line[0], line[1:]
+	p := &miParser{s: line}
+	switch r.Kind {
+	case '~', '@', '&':
+		text, err := p.cstring()
+		if err != nil {
+			return r, err
+		}
+		r.Text = text
+		return r, nil
+	case '^', '*', '+', '=':
+		j := strings.IndexByte(line, ',')
+		if j < 0 {
+			r.Class = line
+			return r, nil
+		}
+		r.Class = line[:j]
+		p.s = line[j:]
+		r.Results = make(map[string]interface{})
+		for p.s != "" {
+			if !p.consume(',') {
+				return r, p.errorf("want ,")
+			}
+			k, v, err := p.result()
+			if err != nil {
+				return r, err
+			}
+			r.Results[k] = v
+		}
+		return r, nil
+	}
+	return r, fmt.Errorf("unknown MI record type %q", r.Kind)
+}
+
+type miParser struct {
+	s string
+}
+
+func (p *miParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("bad MI output at %q: %s", p.s, fmt.Sprintf(format, args...))
+}
+
+func (p *miParser) consume(c byte) bool {
+	if p.s != "" && p.s[0] == c {
+		p.s = p.s[1:]
+		return true
+	}
+	return false
+}
+
+func (p *miParser) result() (string, interface{}, error) {
+	i := strings.IndexByte(p.s, '=')
+	if i <= 0 {
+		return "", nil, p.errorf("want variable=value")
+	}
+	key := p.s[:i]
+	p.s = p.s[i+1:]
+	v, err := p.value()
+	return key, v, err
+}
+
+func (p *miParser) value() (interface{}, error) {
+	if p.s == "" {
+		return nil, p.errorf("want value")
+	}
+	switch p.s[0] {
+	case '"':
+		return p.cstring()
+	case '{':
+		p.s = p.s[1:]
+		tuple := make(map[string]interface{})
+		for !p.consume('}') {
+			if len(tuple) > 0 && !p.consume(',') {
+				return nil, p.errorf("want , or }")
+			}
+			k, v, err := p.result()
+			if err != nil {
+				return nil, err
+			}
+			tuple[k] = v
+		}
+		return tuple, nil
+	case '[':
+		p.s = p.s[1:]
+		var list []interface{}
+		for !p.consume(']') {
+			if len(list) > 0 && !p.consume(',') {
+				return nil, p.errorf("want , or ]")
+			}
+			var v interface{}
+			var err error
+			if p.s != "" && p.s[0] != '"' && p.s[0] != '{' && p.s[0] != '[' {
+				_, v, err = p.result()
+			} else {
+				v, err = p.value()
+			}
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return nil, p.errorf("want value")
+}
+
+// cstring parses a C string, as used by GDB/MI.
+func (p *miParser) cstring() (string, error) {
+	if !p.consume('"') {
+		return "", p.errorf("want \"")
+	}
+	var b strings.Builder
+	for i := 0; i < len(p.s); i++ {
+		switch c := p.s[i]; c {
+		case '"':
+			p.s = p.s[i+1:]
+			return b.String(), nil
+		case '\\':
+			i++
+			if i == len(p.s) {
+				return "", p.errorf("unterminated escape")
+			}
+			switch e := p.s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				// Octal escapes encode non-ASCII bytes.
+				j := i
+				for j < len(p.s) && j < i+3 && '0' <= p.s[j] && p.s[j] <= '7' {
+					j++
+				}
+				n, _ := strconv.ParseUint(p.s[i:j], 8, 8)
+				b.WriteByte(byte(n))
+				i = j - 1
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// miQuote quotes s as a C string, for use in MI commands.
+func miQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// An miConn is a connection to gdb running the MI interpreter.
+type miConn struct {
+	w          io.Writer // gdb's stdin, and the transcript
+	transcript io.Writer
+	r          *bufio.Reader
+	token      int
+	pending    []miRecord // async records that arrived while waiting for a result
+}
+
+// command runs the MI command cmd, returning its result record
+// and any console output it produced.
+func (c *miConn) command(cmd string) (miRecord, string, error) {
+	c.token++
+	token := strconv.Itoa(c.token)
+	if _, err := fmt.Fprintf(c.w, "%s%s\n", token, cmd); err != nil {
+		return miRecord{}, "", err
+	}
+	var console strings.Builder
+	for {
+		r, err := c.next()
+		if err != nil {
+			return r, console.String(), err
+		}
+		switch {
+		case r.Kind == '~':
+			console.WriteString(r.Text)
+		case r.Kind == '^' && r.Token == token:
+			if r.Class == "error" {
+				return r, console.String(), fmt.Errorf("%s", r.String("msg"))
+			}
+			return r, console.String(), nil
+		case r.Kind == '*':
+			c.pending = append(c.pending, r)
+		}
+	}
+}
+
+// console runs a gdb CLI command, returning its output.
+func (c *miConn) console(cmd string) (string, error) {
+	_, out, err := c.command("-interpreter-exec console " + miQuote(cmd))
+	return out, err
+}
+
+// waitStop waits for the inferior to stop, returning the *stopped record.
+func (c *miConn) waitStop() (miRecord, error) {
+	for {
+		if len(c.pending) > 0 {
+			r := c.pending[0]
+			c.pending = c.pending[1:]
+			if r.Class == "stopped" {
+				return r, nil
+			}
+			continue
+		}
+		r, err := c.next()
+		if err != nil {
+			return r, err
+		}
+		if r.Kind == '*' && r.Class == "stopped" {
+			return r, nil
+		}
+	}
+}
+
+// miExecRE matches the start of an exec async record.
+var miExecRE = regexp.MustCompile(`\*(running|stopped)(,|\r?\n|$)`)
+
+// next returns the next MI record, skipping prompts and any
+// lines that aren't MI, such as output from the inferior. Output
+// without a final newline can run into an exec async record, such as
+// *stopped, which is picked out of the line.
+func (c *miConn) next() (miRecord, error) {
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				err = io.ErrUnexpectedEOF
+			}
+			if line == "" {
+				return miRecord{}, err
+			}
+		}
+		r, perr := parseMI(line)
+		if perr == nil {
+			return r, nil
+		}
+		if loc := miExecRE.FindStringIndex(line); loc != nil {
+			if r, perr := parseMI(line[loc[0]:]); perr == nil {
+				return r, nil
+			}
+		}
+		if err != nil {
+			return miRecord{}, err
+		}
+	}
+}
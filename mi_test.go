@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMI(t *testing.T) {
+	tests := []struct {
+		line string
+		want miRecord
+	}{
+		{`^done`, miRecord{Kind: '^', Class: "done"}},
+		{`12^error,msg="No symbol \"x\" in current context."`, miRecord{
+			Token: "12", Kind: '^', Class: "error",
+			Results: map[string]interface{}{"msg": `No symbol "x" in current context.`},
+		}},
+		{`~"$1 = 5\n"`, miRecord{Kind: '~', Text: "$1 = 5\n"}},
+		{`~"caf\303\251"`, miRecord{Kind: '~', Text: "café"}},
+		{`3^done,bkpt={number="1",type="breakpoint",line="12"}`, miRecord{
+			Token: "3", Kind: '^', Class: "done",
+			Results: map[string]interface{}{"bkpt": map[string]interface{}{"number": "1", "type": "breakpoint", "line": "12"}},
+		}},
+		{`*stopped,reason="breakpoint-hit",bkptno="2",frame={func="main.main",args=[]}`, miRecord{
+			Kind: '*', Class: "stopped",
+			Results: map[string]interface{}{
+				"reason": "breakpoint-hit",
+				"bkptno": "2",
+				"frame":  map[string]interface{}{"func": "main.main", "args": []interface{}(nil)},
+			},
+		}},
+		{`^done,numchild="2",children=[child={name="var1.a",exp="a"},child={name="var1.b",exp="b"}]`, miRecord{
+			Kind: '^', Class: "done",
+			Results: map[string]interface{}{
+				"numchild": "2",
+				"children": []interface{}{
+					map[string]interface{}{"name": "var1.a", "exp": "a"},
+					map[string]interface{}{"name": "var1.b", "exp": "b"},
+				},
+			},
+		}},
+		{`^done,list=["a","b"]`, miRecord{
+			Kind: '^', Class: "done",
+			Results: map[string]interface{}{"list": []interface{}{"a", "b"}},
+		}},
+	}
+	for _, tt := range tests {
+		r, err := parseMI(tt.line)
+		if err != nil {
+			t.Errorf("parseMI(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(r, tt.want) {
+			t.Errorf("parseMI(%q) = %+v, want %+v", tt.line, r, tt.want)
+		}
+	}
+
+	if _, err := parseMI("(gdb) \n"); err != io.EOF {
+		t.Errorf("parseMI of prompt: %v, want io.EOF", err)
+	}
+	for _, line := range []string{`~"unterminated`, `^done,x=`, `^done,x={a="1"`, `hello`} {
+		if _, err := parseMI(line); err == nil {
+			t.Errorf("parseMI(%q) succeeded, want error", line)
+		}
+	}
+}
+
+func TestMIQuote(t *testing.T) {
+	s := "a \"b\" \\c\nd"
+	p := &miParser{s: miQuote(s)}
+	have, err := p.cstring()
+	if err != nil || have != s {
+		t.Errorf("cstring(miQuote(%q)) = %q, %v", s, have, err)
+	}
+}
+
+func TestSignalHandling(t *testing.T) {
+	info := "Signal        Stop\tPrint\tPass to program\tDescription\n" +
+		"SIGURG        No\tNo\tYes\t\tUrgent I/O condition\n"
+	if have, want := signalHandling(info, "SIGURG"), " nostop noprint pass"; have != want {
+		t.Errorf("signalHandling(SIGURG) = %q, want %q", have, want)
+	}
+	if have := signalHandling(info, "SIGSEGV"); have != "" {
+		t.Errorf("signalHandling(SIGSEGV) = %q, want \"\"", have)
+	}
+}
+
+func TestMIConn(t *testing.T) {
+	out := strings.Join([]string{
+		`=thread-group-added,id="i1"`,
+		`(gdb) `,
+		`1^running`,
+		`*running,thread-id="all"`,
+		`inferior output`,
+		`(gdb) `,
+		`~"x = 1\n"`,
+		`2^done`,
+		`x*stopped,reason="breakpoint-hit",bkptno="1"`,
+		`3^error,msg="oops"`,
+		``,
+	}, "\n")
+	var in bytes.Buffer
+	c := &miConn{w: &in, r: bufio.NewReader(strings.NewReader(out))}
+
+	if r, _, err := c.command("-exec-run"); err != nil || r.Class != "running" {
+		t.Fatalf("-exec-run: %+v, %v", r, err)
+	}
+	if text, err := c.console("info locals"); err != nil || text != "x = 1\n" {
+		t.Fatalf("info locals: %q, %v", text, err)
+	}
+	stop, err := c.waitStop()
+	if err != nil || stop.String("bkptno") != "1" {
+		t.Fatalf("waitStop: %+v, %v", stop, err)
+	}
+	if _, _, err := c.command("-exec-continue"); err == nil || err.Error() != "oops" {
+		t.Fatalf("-exec-continue: %v, want oops", err)
+	}
+	if _, _, err := c.command("-gdb-exit"); err != io.ErrUnexpectedEOF {
+		t.Fatalf("command after EOF: %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	want := "1-exec-run\n2-interpreter-exec console \"info locals\"\n3-exec-continue\n4-gdb-exit\n"
+	if in.String() != want {
+		t.Errorf("commands sent:\n%s\nwant:\n%s", in.String(), want)
+	}
+}
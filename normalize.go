@@ -0,0 +1,171 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// This file mirrors the output normalization done by the gdb and lldb
+// scripts, gdbNormalizePython and lldbNormalizePython, for the backends
+// that are implemented in Go. normalize_test.go checks each pair against
+// the same cases.
+
+var (
+	historyRE  = regexp.MustCompile(`^(\(.*?\) )?\$[0-9]+ = `)
+	gdbTypeRE  = regexp.MustCompile(`^\(.*?\) 0x`)
+	gdbFrameRE = regexp.MustCompile(`^#([0-9]+)\s+(?:0x[0-9a-f]+ in )?(\S+) \(.*?\)(?: at (\S+):([0-9]+))?`)
+
+	lldbVarRE       = regexp.MustCompile(`^\(.*?\) (\S+ = )?`)
+	lldbChildTypeRE = regexp.MustCompile(`^\(.*?\) `)
+	lldbFrameRE     = regexp.MustCompile("frame #([0-9]+): (?:0x[0-9a-f]+ )?(?:\\S+?`)?(\\S+?)(?:\\(.*\\))?(?: at ([^:\\s]+):([0-9]+)(?::[0-9]+)?)?$")
+)
+
+// normalizeOutput rewrites out, the output of a command run in a debugger
+// whose output looks like style's ("gdb", "lldb" or "dap"), as named by
+// norm. See Test.Normalization.
+func normalizeOutput(style, norm, out string) string {
+	if style == "dap" {
+		// The DAP backend formats structured responses
+		// in the portable form itself.
+		return out
+	}
+	if norm == "history" {
+		if m := historyRE.FindStringSubmatch(out); m != nil {
+			return m[1] + "$N = " + out[len(m[0]):]
+		}
+		return out
+	}
+	if style == "lldb" {
+		switch norm {
+		case "print":
+			return lldbNormalizePrint(out)
+		case "locals":
+			return lldbNormalizeLocals(out)
+		case "bt":
+			return lldbNormalizeBacktrace(out)
+		}
+		return out
+	}
+	switch norm {
+	case "print":
+		return gdbNormalizePrint(out)
+	case "locals":
+		return gdbNormalizeLocals(out)
+	case "bt":
+		return gdbNormalizeBacktrace(out)
+	}
+	return out
+}
+
+// joinLines joins a multi-line composite value into a single line.
+func joinLines(lines []string) string {
+	out := ""
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(out, ","):
+			out += " "
+		case out != "" && !strings.HasSuffix(out, "{") && !strings.HasSuffix(out, ", ") && !strings.HasPrefix(l, "}"):
+			out += ", "
+		}
+		out += l
+	}
+	return out
+}
+
+func gdbStripType(s string) string {
+	if loc := gdbTypeRE.FindStringIndex(s); loc != nil {
+		return "0x" + s[loc[1]:]
+	}
+	return s
+}
+
+func gdbNormalizePrint(out string) string {
+	out = historyRE.ReplaceAllString(out, "")
+	return gdbStripType(joinLines(strings.Split(out, "\n")))
+}
+
+func gdbNormalizeLocals(out string) string {
+	var locals []string
+	for _, l := range strings.Split(out, "\n") {
+		l = strings.TrimSpace(l)
+		if i := strings.Index(l, " = "); i >= 0 {
+			locals = append(locals, l[:i+3]+gdbStripType(l[i+3:]))
+		}
+	}
+	sort.Strings(locals)
+	return strings.Join(locals, "\n")
+}
+
+func gdbNormalizeBacktrace(out string) string {
+	var frames []string
+	for _, l := range strings.Split(out, "\n") {
+		m := gdbFrameRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		frame := "#" + m[1] + " " + m[2]
+		if m[3] != "" {
+			frame += " at " + filepath.Base(m[3]) + ":" + m[4]
+		}
+		frames = append(frames, frame)
+	}
+	return strings.Join(frames, "\n")
+}
+
+func lldbNormalizePrint(out string) string {
+	lines := splitLines(out)
+	if len(lines) == 0 {
+		return ""
+	}
+	lines[0] = lldbVarRE.ReplaceAllString(historyRE.ReplaceAllString(lines[0], ""), "")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = lldbChildTypeRE.ReplaceAllString(strings.TrimSpace(lines[i]), "")
+	}
+	return joinLines(lines)
+}
+
+func lldbNormalizeLocals(out string) string {
+	var entries [][]string
+	for _, l := range splitLines(out) {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if len(entries) > 0 && (l[0] == ' ' || l[0] == '\t' || strings.HasPrefix(l, "}")) {
+			entries[len(entries)-1] = append(entries[len(entries)-1], l)
+		} else {
+			entries = append(entries, []string{l})
+		}
+	}
+	var locals []string
+	for _, e := range entries {
+		name := ""
+		if m := lldbVarRE.FindStringSubmatch(e[0]); m != nil {
+			name = m[1]
+		}
+		locals = append(locals, name+lldbNormalizePrint(strings.Join(e, "\n")))
+	}
+	sort.Strings(locals)
+	return strings.Join(locals, "\n")
+}
+
+func lldbNormalizeBacktrace(out string) string {
+	var frames []string
+	for _, l := range splitLines(out) {
+		m := lldbFrameRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		frame := "#" + m[1] + " " + m[2]
+		if m[3] != "" {
+			frame += " at " + filepath.Base(m[3]) + ":" + m[4]
+		}
+		frames = append(frames, frame)
+	}
+	return strings.Join(frames, "\n")
+}
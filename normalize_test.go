@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// A normalizeTest is a case of the output normalization of one debugger.
+type normalizeTest struct {
+	Norm string `json:"norm"`
+	In   string `json:"in"`
+	Want string `json:"want"`
+}
+
+// normalizeTests are cases of the gdb output normalization, which both
+// normalizeOutput and the gdb script's Python must get right.
+var normalizeTests = []normalizeTest{
+	{"history", "$12 = 5\n", "$N = 5\n"},
+	{"history", "(int) $3 = 5\n", "(int) $N = 5\n"},
+	{"history", "no history\n", "no history\n"},
+	{"raw", "$12 = 5\n", "$12 = 5\n"},
+	{"print", "$1 = 5\n", "5"},
+	{"print", "$2 = (*main.T) 0xc000012345\n", "0xc000012345"},
+	{"print", "$3 = {\n  Field = 1,\n  Name = \"x\"\n}\n", `{Field = 1, Name = "x"}`},
+	{"print", "$4 = {1, 2, 3}", "{1, 2, 3}"},
+	{"locals", "s = {1, 2}\ni = 5\np = (*int) 0xc000012345\n", "i = 5\np = 0xc000012345\ns = {1, 2}"},
+	{"locals", "No locals.\n", ""},
+	{"bt", "#0  main.f (x=1) at /tmp/x/x.go:12\n#1  0x0000000000497788 in main.main () at /tmp/x/x.go:20\n", "#0 main.f at x.go:12\n#1 main.main at x.go:20"},
+	{"bt", "#2  0x000000000043a3c1 in runtime.goexit ()\n", "#2 runtime.goexit"},
+}
+
+// lldbNormalizeTests are cases of the lldb output normalization, which
+// both normalizeOutput, for lldb-dap's REPL, and the lldb script's
+// Python must get right.
+var lldbNormalizeTests = []normalizeTest{
+	{"history", "(int) $0 = 5\n", "(int) $N = 5\n"},
+	{"history", "(main.T) t = {}\n", "(main.T) t = {}\n"},
+	{"print", "(int) i = 5\n", "5"},
+	{"print", "(main.T) t = {\n  A = 1\n  (string) B = \"x\"\n}\n", `{A = 1, B = "x"}`},
+	{"locals", "(main.T) t = {\n  A = 1\n}\n(int) i = 5\n", "i = 5\nt = {A = 1}"},
+	{"bt", "* thread #1, name = 'x', stop reason = breakpoint 1.1\n  * frame #0: 0x0000000000497788 x`main.f(x=1) at x.go:12:3\n    frame #1: 0x00000000004977aa x`main.main at /tmp/x/x.go:20\n", "#0 main.f at x.go:12\n#1 main.main at x.go:20"},
+}
+
+func TestNormalizeOutput(t *testing.T) {
+	for _, tt := range normalizeTests {
+		if got := normalizeOutput("gdb", tt.Norm, tt.In); got != tt.Want {
+			t.Errorf("normalizeOutput(gdb, %s, %q) = %q, want %q", tt.Norm, tt.In, got, tt.Want)
+		}
+	}
+	for _, tt := range lldbNormalizeTests {
+		if got := normalizeOutput("lldb", tt.Norm, tt.In); got != tt.Want {
+			t.Errorf("normalizeOutput(lldb, %s, %q) = %q, want %q", tt.Norm, tt.In, got, tt.Want)
+		}
+	}
+	if got := normalizeOutput("dap", "print", "$1 = 5"); got != "$1 = 5" {
+		t.Errorf("normalizeOutput(dap) = %q, want it unchanged", got)
+	}
+}
+
+// TestNormalizePython checks the scripts' normalization against the
+// same cases as normalizeOutput, so that the two don't drift apart.
+func TestNormalizePython(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("no python3")
+	}
+	checkNormalizePython(t, python, "gdb", gdbNormalizePython, normalizeTests)
+	checkNormalizePython(t, python, "lldb", lldbNormalizePython, lldbNormalizeTests)
+}
+
+// checkNormalizePython checks normalize, the Python normalization of
+// debugger's script, against tests.
+func checkNormalizePython(t *testing.T, python, debugger, normalize string, tests []normalizeTest) {
+	dir := t.TempDir()
+	cases, err := json.Marshal(tests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	casesPath := filepath.Join(dir, "cases.json")
+	if err := ioutil.WriteFile(casesPath, cases, 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := "import json\nimport os\nimport re\nimport sys\n" + normalize + `
+for c in json.load(open(sys.argv[1])):
+	got = normalize(c["norm"], c["in"])
+	if got != c["want"]:
+		print("normalize(%s, %r) = %r, want %r" % (c["norm"], c["in"], got, c["want"]))
+`
+	scriptPath := filepath.Join(dir, "normalize.py")
+	if err := ioutil.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(python, scriptPath, casesPath)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s: %v", python, err)
+	}
+	if len(out) > 0 {
+		t.Errorf("the %s script's normalization disagrees:\n%s", debugger, out)
+	}
+}
@@ -5,24 +5,140 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 type Test struct {
 	Line     int      // line the command occurred on
-	Debugger string   // Which debugger is this a test for? "gdb" or "lldb"
-	Command  string   // debugger command to run
-	Want     []string // regex desired response
+	Debugger string   // Which debugger is this a test for? "gdb", "lldb", "dap", "any" or "value"
+	Command  string   // debugger command to run; for "value", the expression to evaluate
+	Want     []string // regex desired response; for "value", a Go expression
+}
+
+// printCommands lists, per debugger, the commands whose output
+// starts with a value history prefix such as "$1 = " or "(int) $0 = ".
+var printCommands = map[string][]string{
+	"gdb":  {"print", "p", "inspect", "call"},
+	"lldb": {"print", "p", "expression", "expr", "call"},
+}
+
+// Normalize reports whether t's output has a value history prefix to
+// rewrite to the canonical "$N" before matching. It is rewritten if
+// ScriptContext.Normalize is set, as it is by -normalize.
+func (t Test) Normalize() bool {
+	verb := t.Command
+	if i := strings.IndexAny(verb, " /"); i >= 0 {
+		verb = verb[:i]
+	}
+	for _, cmd := range printCommands[t.Debugger] {
+		if verb == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalization names the rewriting applied to t's output before
+// matching: the verb for (any) tests, "history" if t.Normalize(),
+// and "" otherwise.
+func (t Test) Normalization() string {
+	if t.Debugger == "any" {
+		verb, _ := t.Portable()
+		return verb
+	}
+	if t.Normalize() {
+		return "history"
+	}
+	return ""
 }
 
 type Breakpoint struct {
 	Filename string
 	Line     int    // line the breakpoint is set at
+	Kind     string // "" for a BREAKPOINT, "core" for CORE, "attach" for ATTACH, "panic" for PANIC, "signal" for SIGNAL
 	Tests    []Test // tests to run when this breakpoint is hit
+
+	// For PANIC and SIGNAL markers.
+	Signal   string // signal to catch, such as SIGSEGV
+	StopLine int    // line expected to panic or fault: the one after the marker
+}
+
+// markers maps the first line of a marker comment group to its Breakpoint.Kind.
+// SIGNAL markers also name a signal, as in "// SIGNAL SIGSEGV".
+var markers = map[string]string{
+	"// BREAKPOINT": "",
+	"// CORE":       "core",
+	"// ATTACH":     "attach",
+	"// PANIC":      "panic",
+	"// SIGNAL":     "signal",
+}
+
+// signalRe matches the signal names allowed in SIGNAL markers.
+var signalRe = regexp.MustCompile(`^SIG[A-Z0-9]+$`)
+
+// A File is a parsed test program.
+type File struct {
+	Breakpoints []Breakpoint
+
+	// Set by //debugo: directives, for running the program.
+	Args  []string // //debugo:args -flag value
+	Env   []string // //debugo:env KEY=value, added to the environment
+	Stdin string   // //debugo:stdin path, relative to the source file
+
+	// Set by //debugo:requires gdb-python ..., for which debuggers
+	// to run the program in; see knownCapabilities.
+	Requires []string
+
+	Expect Expect
+	DWARF  []DWARFCheck // // DWARF directives
+}
+
+// A DWARFCheck is a // DWARF directive, which is checked against the
+// debug info of the built executable rather than in a debugger:
+//
+//	// DWARF var i type=int location=present
+//	// DWARF line 12 is_stmt
+type DWARFCheck struct {
+	Line int    // line of the directive
+	Kind string // "var" or "line"
+
+	// For var, the variable, in the function containing the directive.
+	Func     string // as named in DWARF, such as main.(*T).M
+	Var      string
+	Type     string // if set, the name of the variable's type
+	Location string // if set, "present" or "absent"
+
+	// For line, whether the line table has the line, and a statement on it.
+	SrcLine int
+	IsStmt  bool
+}
+
+// Expect holds the expectations for how a program behaves when run under
+// a debugger, set by EXPECT directives.
+type Expect struct {
+	Exit       *int     // // EXPECT-EXIT 0
+	ExitLine   int      // line of the EXPECT-EXIT directive
+	Stdout     []string // // EXPECT-STDOUT regex, one per line of output
+	StdoutLine int      // line of the first EXPECT-STDOUT directive
+	Stderr     []string // // EXPECT-STDERR regex, one per line of output
+	StderrLine int      // line of the first EXPECT-STDERR directive
 }
 
 func Parse(filename string) ([]Breakpoint, error) {
-	var bps []Breakpoint
+	f, err := ParseFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return f.Breakpoints, nil
+}
+
+func ParseFile(filename string) (*File, error) {
+	file := new(File)
+	var crash *Breakpoint // the PANIC or SIGNAL marker
 
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
@@ -31,17 +147,206 @@ func Parse(filename string) ([]Breakpoint, error) {
 	}
 
 	for _, cg := range f.Comments {
-		if cg.List[0].Text != "// BREAKPOINT" {
+		for _, c := range cg.List {
+			lineno := fset.Position(c.Pos()).Line
+			if strings.HasPrefix(c.Text, "//debugo:") {
+				if err := file.parseDirective(c.Text); err != nil {
+					return nil, fmt.Errorf("%s:%d %v", filename, lineno, err)
+				}
+			}
+			if strings.HasPrefix(c.Text, "// DWARF ") {
+				check, err := parseDWARF(c.Text, lineno)
+				if err == nil && check.Kind == "var" {
+					check.Func, err = enclosingFunc(f, c.Pos())
+				}
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d %v", filename, lineno, err)
+				}
+				file.DWARF = append(file.DWARF, check)
+			}
+			if strings.HasPrefix(c.Text, "// EXPECT-") {
+				if err := file.Expect.parse(c.Text, lineno); err != nil {
+					return nil, fmt.Errorf("%s:%d %v", filename, lineno, err)
+				}
+			}
+		}
+
+		marker, signal := cg.List[0].Text, ""
+		if strings.HasPrefix(marker, "// SIGNAL ") {
+			marker, signal = "// SIGNAL", strings.TrimSpace(marker[len("// SIGNAL "):])
+		}
+		kind, ok := markers[marker]
+		if !ok {
 			continue
 		}
 		bp, err := parseBreakpoint(fset, filename, cg)
 		if err != nil {
 			return nil, err
 		}
-		bps = append(bps, bp)
+		bp.Kind = kind
+		switch kind {
+		case "signal":
+			if !signalRe.MatchString(signal) {
+				return nil, fmt.Errorf("%s:%d SIGNAL wants a signal name, such as SIGSEGV", filename, bp.Line)
+			}
+			bp.Signal = signal
+			fallthrough
+		case "panic":
+			// The program stops for good, so there is only one.
+			if crash != nil {
+				return nil, fmt.Errorf("%s:%d only one PANIC or SIGNAL marker is allowed per program", filename, bp.Line)
+			}
+			bp.StopLine = fset.Position(cg.End()).Line + 1
+			crash = &bp
+		}
+		file.Breakpoints = append(file.Breakpoints, bp)
 	}
 
-	return bps, nil
+	if file.Stdin != "" && !filepath.IsAbs(file.Stdin) {
+		// The debuggers run in other directories.
+		file.Stdin, err = filepath.Abs(filepath.Join(filepath.Dir(filename), file.Stdin))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// parseDirective parses a //debugo: directive.
+func (f *File) parseDirective(text string) error {
+	text = strings.TrimPrefix(text, "//debugo:")
+	name, arg := text, ""
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		name, arg = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	switch name {
+	case "args":
+		args, err := shellSplit(arg)
+		if err != nil {
+			return fmt.Errorf("//debugo:args: %v", err)
+		}
+		f.Args = append(f.Args, args...)
+	case "env":
+		if !strings.Contains(arg, "=") {
+			return fmt.Errorf("//debugo:env wants KEY=value, have %q", arg)
+		}
+		f.Env = append(f.Env, arg)
+	case "stdin":
+		if arg == "" || f.Stdin != "" {
+			return fmt.Errorf("//debugo:stdin wants a single file")
+		}
+		f.Stdin = arg
+	case "requires":
+		for _, req := range strings.Fields(arg) {
+			if knownCapabilities[req] == "" {
+				return fmt.Errorf("//debugo:requires: unknown capability %q", req)
+			}
+			f.Requires = append(f.Requires, req)
+		}
+	default:
+		return fmt.Errorf("unknown directive //debugo:%s", name)
+	}
+	return nil
+}
+
+// parse parses an EXPECT directive on line lineno.
+func (e *Expect) parse(text string, lineno int) error {
+	name, arg := strings.TrimPrefix(text, "// "), ""
+	if i := strings.IndexByte(name, ' '); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i+1:])
+	}
+	switch name {
+	case "EXPECT-EXIT":
+		if e.Exit != nil {
+			return fmt.Errorf("duplicate EXPECT-EXIT")
+		}
+		code, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("EXPECT-EXIT wants an exit status: %v", err)
+		}
+		e.Exit, e.ExitLine = &code, lineno
+	case "EXPECT-STDOUT":
+		// A bare EXPECT-STDOUT expects an empty line.
+		if e.Stdout == nil {
+			e.StdoutLine = lineno
+		}
+		e.Stdout = append(e.Stdout, arg)
+	case "EXPECT-STDERR":
+		if e.Stderr == nil {
+			e.StderrLine = lineno
+		}
+		e.Stderr = append(e.Stderr, arg)
+	default:
+		return fmt.Errorf("unknown directive %s", name)
+	}
+	return nil
+}
+
+// parseDWARF parses a // DWARF directive on line lineno.
+func parseDWARF(text string, lineno int) (DWARFCheck, error) {
+	check := DWARFCheck{Line: lineno}
+	f := strings.Fields(strings.TrimPrefix(text, "// DWARF "))
+	if len(f) < 2 {
+		return check, fmt.Errorf("want // DWARF var <name> [key=value ...] or // DWARF line <n> [is_stmt]")
+	}
+	check.Kind = f[0]
+	switch check.Kind {
+	case "var":
+		check.Var = f[1]
+		for _, kv := range f[2:] {
+			i := strings.IndexByte(kv, '=')
+			if i < 0 {
+				return check, fmt.Errorf("DWARF var wants key=value, have %q", kv)
+			}
+			switch key, value := kv[:i], kv[i+1:]; key {
+			case "type":
+				check.Type = value
+			case "location":
+				if value != "present" && value != "absent" {
+					return check, fmt.Errorf("DWARF var location is present or absent, not %q", value)
+				}
+				check.Location = value
+			default:
+				return check, fmt.Errorf("unknown DWARF var key %q", key)
+			}
+		}
+	case "line":
+		n, err := strconv.Atoi(f[1])
+		if err != nil {
+			return check, fmt.Errorf("DWARF line wants a line number: %v", err)
+		}
+		check.SrcLine = n
+		for _, flag := range f[2:] {
+			if flag != "is_stmt" {
+				return check, fmt.Errorf("unknown DWARF line flag %q", flag)
+			}
+			check.IsStmt = true
+		}
+	default:
+		return check, fmt.Errorf("unknown DWARF check %q", check.Kind)
+	}
+	return check, nil
+}
+
+// enclosingFunc returns the DWARF name of the function in f containing pos.
+func enclosingFunc(f *ast.File, pos token.Pos) (string, error) {
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || pos < fd.Pos() || pos > fd.End() {
+			continue
+		}
+		name := fd.Name.Name
+		if fd.Recv != nil && len(fd.Recv.List) == 1 {
+			switch t := fd.Recv.List[0].Type.(type) {
+			case *ast.StarExpr:
+				name = "(*" + types.ExprString(t.X) + ")." + name
+			default:
+				name = types.ExprString(t) + "." + name
+			}
+		}
+		return f.Name.Name + "." + name, nil
+	}
+	return "", fmt.Errorf("DWARF var must be inside a function")
 }
 
 func parseBreakpoint(fset *token.FileSet, filename string, cg *ast.CommentGroup) (Breakpoint, error) {
@@ -82,13 +387,49 @@ func parseBreakpoint(fset *token.FileSet, filename string, cg *ast.CommentGroup)
 				Line:     lineno,
 			}
 			continue
+		case strings.HasPrefix(line, "(dap) "):
+			appendTest()
+			t = Test{
+				Debugger: "dap",
+				Command:  strings.TrimSpace(line[len("(dap)"):]),
+				Line:     lineno,
+			}
+			continue
+		case strings.HasPrefix(line, "(any) "):
+			appendTest()
+			t = Test{
+				Debugger: "any",
+				Command:  strings.TrimSpace(line[len("(any)"):]),
+				Line:     lineno,
+			}
+			if err := t.checkPortable(); err != nil {
+				return bp, fmt.Errorf("%s:%d %v", filename, lineno, err)
+			}
+			continue
+		case strings.HasPrefix(line, "(value) "):
+			appendTest()
+			expr, want, err := ParseValueTest(strings.TrimSpace(line[len("(value)"):]))
+			if err != nil {
+				return bp, fmt.Errorf("%s:%d %v", filename, lineno, err)
+			}
+			bp.Tests = append(bp.Tests, Test{
+				Debugger: "value",
+				Command:  expr,
+				Want:     []string{want},
+				Line:     lineno,
+			})
+			t = Test{}
+			continue
+		case strings.HasPrefix(line, "DWARF "), strings.HasPrefix(line, "EXPECT-"):
+			// A file directive, read by ParseFile; not a Want.
+			continue
 		}
 
 		// Not a new test; must be a Want from the current test.
 
 		if t.Debugger == "" {
 			// Oops, no current test
-			return bp, fmt.Errorf("%s:%d expected a (gdb) or (lldb) command", filename, lineno)
+			return bp, fmt.Errorf("%s:%d expected a (gdb), (lldb), (dap), (any) or (value) command", filename, lineno)
 		}
 
 		t.Want = append(t.Want, line)
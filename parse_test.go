@@ -1,6 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -27,9 +30,138 @@ func TestParse(t *testing.T) {
 				Test{Line: 17, Debugger: "gdb", Command: "cmd4", Want: []string{"want4a", "want4b"}},
 			},
 		},
+		// Portable
+		Breakpoint{Filename: filename, Line: 30,
+			Tests: []Test{
+				Test{Line: 31, Debugger: "any", Command: "print x", Want: []string{"want5"}},
+				Test{Line: 33, Debugger: "value", Command: "s[1]", Want: []string{"[]int{1, 2}"}},
+				Test{Line: 34, Debugger: "any", Command: "locals", Want: []string{"want6"}},
+				Test{Line: 36, Debugger: "dap", Command: "x + 1", Want: []string{"want7"}},
+			},
+		},
+		// Core
+		Breakpoint{Filename: filename, Line: 41, Kind: "core",
+			Tests: []Test{
+				Test{Line: 42, Debugger: "gdb", Command: "bt", Want: []string{"want8"}},
+			},
+		},
+		// Attach
+		Breakpoint{Filename: filename, Line: 47, Kind: "attach",
+			Tests: []Test{
+				Test{Line: 48, Debugger: "lldb", Command: "bt", Want: []string{"want9"}},
+			},
+		},
+		// Panic
+		Breakpoint{Filename: filename, Line: 53, Kind: "panic", StopLine: 56,
+			Tests: []Test{
+				Test{Line: 54, Debugger: "gdb", Command: "bt", Want: []string{"want10"}},
+			},
+		},
 	}
 
 	if !reflect.DeepEqual(bps, want) {
 		t.Errorf("parsed incorrectly: got %v, want %v", bps, want)
 	}
 }
+
+func TestParseSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugo-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	parse := func(body string) ([]Breakpoint, error) {
+		filename := filepath.Join(dir, "x.go")
+		if err := ioutil.WriteFile(filename, []byte("package main\n\nfunc main() {\n"+body+"}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Parse(filename)
+	}
+
+	bps, err := parse("\t// SIGNAL SIGSEGV\n\t// (gdb) bt\n\t// want\n\t_ = *(*int)(nil)\n")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if len(bps) != 1 || bps[0].Kind != "signal" || bps[0].Signal != "SIGSEGV" || bps[0].Line != 4 || bps[0].StopLine != 7 {
+		t.Errorf("parsed incorrectly: got %+v", bps)
+	}
+
+	bps, err = parse("\tx := 1\n\t// BREAKPOINT\n\t// (gdb) print x\n\t// 1\n\t// DWARF var x type=int\n\t// EXPECT-EXIT 0\n\tf(x)\n")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if len(bps) != 1 || len(bps[0].Tests) != 1 || !reflect.DeepEqual(bps[0].Tests[0].Want, []string{"1"}) {
+		t.Errorf("DWARF and EXPECT- lines taken as wants: got %+v", bps)
+	}
+
+	for _, body := range []string{
+		"\t// BREAKPOINT\n\t// (any) locals foo\n\t// x\n\tf()\n",
+		"\t// BREAKPOINT\n\t// (any) print\n\t// x\n\tf()\n",
+		"\t// BREAKPOINT\n\t// (any) info frame\n\t// x\n\tf()\n",
+		"\t// SIGNAL segv\n",
+		"\t// SIGNAL\n",
+		"\t// PANIC\n\tf()\n\t// SIGNAL SIGSEGV\n\tg()\n",
+	} {
+		if _, err := parse(body); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", body)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	f, err := ParseFile("testdata/directives.go")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if want := []string{"-v", "x", "y z", ""}; !reflect.DeepEqual(f.Args, want) {
+		t.Errorf("Args = %q, want %q", f.Args, want)
+	}
+	if want := []string{"A=1", "B=two words"}; !reflect.DeepEqual(f.Env, want) {
+		t.Errorf("Env = %q, want %q", f.Env, want)
+	}
+	if want, _ := filepath.Abs("testdata/in.txt"); f.Stdin != want {
+		t.Errorf("Stdin = %q, want %q", f.Stdin, want)
+	}
+	if want := []string{"gdb-python", "gdb-go"}; !reflect.DeepEqual(f.Requires, want) {
+		t.Errorf("Requires = %q, want %q", f.Requires, want)
+	}
+	if e := f.Expect; e.Exit == nil || *e.Exit != 3 || e.ExitLine != 10 {
+		t.Errorf("Expect.Exit = %v at line %d, want 3 at line 10", e.Exit, e.ExitLine)
+	}
+	if e := f.Expect; !reflect.DeepEqual(e.Stdout, []string{"hello", ""}) || e.StdoutLine != 11 {
+		t.Errorf("Expect.Stdout = %q at line %d, want [hello ] at line 11", e.Stdout, e.StdoutLine)
+	}
+	if len(f.Breakpoints) != 1 {
+		t.Errorf("got %d breakpoints, want 1", len(f.Breakpoints))
+	}
+
+	for _, text := range []string{"//debugo:env A", "//debugo:stdin", "//debugo:bogus x", "//debugo:requires gdb-magic", "//debugo:args 'x"} {
+		if err := new(File).parseDirective(text); err == nil {
+			t.Errorf("parseDirective(%q) succeeded, want error", text)
+		}
+	}
+	for _, text := range []string{"// EXPECT-EXIT", "// EXPECT-EXIT x", "// EXPECT-STDIN x"} {
+		if err := new(Expect).parse(text, 1); err == nil {
+			t.Errorf("Expect.parse(%q) succeeded, want error", text)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		test Test
+		want bool
+	}{
+		{Test{Debugger: "gdb", Command: "print i"}, true},
+		{Test{Debugger: "gdb", Command: "p/x i"}, true},
+		{Test{Debugger: "gdb", Command: "info locals"}, false},
+		{Test{Debugger: "gdb", Command: "printf \"%d\", i"}, false},
+		{Test{Debugger: "lldb", Command: "expr -- i"}, true},
+		{Test{Debugger: "lldb", Command: "frame variable i"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.test.Normalize(); got != tt.want {
+			t.Errorf("%s %q: Normalize() = %v, want %v", tt.test.Debugger, tt.test.Command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+// The result protocol.
+//
+// Debugger scripts report to debugo over a Unix socket, one JSON
+// message per line. Each run of a debugger gets its own socket and
+// run ID, and makes exactly one connection.
+//
+// A run begins with a handshake:
+//
+//	{"type": "hello", "version": 1, "run": "3", "debugger": "gdb", "debugger_version": "14.2"}
+//
+// The version is protocolVersion; the run ID and debugger name must match
+// those debugo passed to the script. Then come any number of results,
+// each carrying the fields of a TestResult:
+//
+//	{"type": "result", "status": "PASS", "file": "x.go", "line": 12, "have": "5\n"}
+//
+// The run ends with an explicit end message giving the number of results sent:
+//
+//	{"type": "end", "results": 7}
+//
+// A connection that closes before the end message, or whose result count
+// does not match, is reported as a truncated run rather than treated as
+// complete.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const protocolVersion = 1
+
+// maxMessage is the longest protocol message accepted.
+// Value trees and command output can be large.
+const maxMessage = 16 << 20
+
+// acceptGrace is how long to wait for a connection
+// after the debugger has exited. It is a variable for testing.
+var acceptGrace = time.Second
+
+// message is a single protocol message.
+type message struct {
+	Type            string `json:"type"` // "hello", "result", "end"
+	Version         int    `json:"version,omitempty"`
+	Run             string `json:"run,omitempty"`
+	Debugger        string `json:"debugger,omitempty"`
+	DebuggerVersion string `json:"debugger_version,omitempty"`
+	Results         int    `json:"results,omitempty"`
+	TestResult
+}
+
+// collect handles the results of a single run, reported on l.
+// The handle function is called from collect's goroutine, in order,
+// once for each result. Exited must be closed when the debugger exits,
+// at which point collect stops waiting for it to connect. Collect closes l,
+// and does not return until every result has been handled.
+func collect(l net.Listener, runID, debugger string, exited <-chan struct{}, handle func(TestResult)) (hello message, err error) {
+	// The receiver is the only sender on resc, and closes it when done,
+	// so ranging over resc below drains every result.
+	resc := make(chan TestResult)
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(resc)
+		var err error
+		hello, err = receive(l, runID, debugger, resc)
+		recvErr <- err
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-exited:
+			// Stop waiting for a debugger that never connected. A connection
+			// made just before the debugger exited may still be queued, so
+			// allow a grace period rather than closing the listener outright.
+			if dl, ok := l.(interface{ SetDeadline(time.Time) error }); ok {
+				dl.SetDeadline(time.Now().Add(acceptGrace))
+			} else {
+				l.Close()
+			}
+		case <-done:
+		}
+	}()
+
+	for res := range resc {
+		handle(res)
+	}
+	l.Close()
+	err = <-recvErr
+	return hello, err
+}
+
+// receive accepts a single connection on l and reads a run from it.
+func receive(l net.Listener, runID, debugger string, resc chan<- TestResult) (hello message, err error) {
+	conn, err := l.Accept()
+	if err != nil {
+		return hello, fmt.Errorf("%s never connected: %v", debugger, err)
+	}
+	defer conn.Close()
+	return readRun(conn, runID, debugger, resc)
+}
+
+// readRun reads the messages of a single run from r,
+// sending results to resc. It returns the handshake.
+func readRun(r io.Reader, runID, debugger string, resc chan<- TestResult) (hello message, err error) {
+	scan := bufio.NewScanner(r)
+	scan.Buffer(nil, maxMessage)
+
+	next := func() (message, error) {
+		var msg message
+		if !scan.Scan() {
+			if err := scan.Err(); err != nil {
+				return msg, err
+			}
+			return msg, io.EOF
+		}
+		if err := json.Unmarshal(scan.Bytes(), &msg); err != nil {
+			return msg, fmt.Errorf("bad message %q: %v", scan.Bytes(), err)
+		}
+		return msg, nil
+	}
+
+	hello, err = next()
+	switch {
+	case err == io.EOF:
+		return hello, fmt.Errorf("connection closed before handshake")
+	case err != nil:
+		return hello, err
+	case hello.Type != "hello":
+		return hello, fmt.Errorf("want hello message, have %q", hello.Type)
+	case hello.Version != protocolVersion:
+		return hello, fmt.Errorf("protocol version %d, want %d", hello.Version, protocolVersion)
+	case hello.Run != runID:
+		return hello, fmt.Errorf("run ID %q, want %q", hello.Run, runID)
+	case hello.Debugger != debugger:
+		return hello, fmt.Errorf("debugger %q, want %q", hello.Debugger, debugger)
+	}
+
+	n := 0
+	for {
+		msg, err := next()
+		if err == io.EOF {
+			return hello, fmt.Errorf("run truncated after %d results: connection closed without end message", n)
+		}
+		if err != nil {
+			return hello, err
+		}
+		switch msg.Type {
+		case "result":
+			n++
+			resc <- msg.TestResult
+		case "end":
+			if msg.Results != n {
+				return hello, fmt.Errorf("run truncated: end message reports %d results, received %d", msg.Results, n)
+			}
+			return hello, nil
+		default:
+			return hello, fmt.Errorf("unknown message type %q", msg.Type)
+		}
+	}
+}
+
+// A reportConn is the sending side of the protocol, used by
+// debugger backends that are implemented in Go rather than scripts.
+type reportConn struct {
+	conn       net.Conn
+	enc        *json.Encoder
+	sent       int
+	transcript io.Writer // where each result is marked, as the scripts do
+}
+
+// dialReport connects to sock and performs the handshake. The results
+// sent are marked in transcript.
+func dialReport(sock, runID, debugger, debuggerVersion string, transcript io.Writer) (*reportConn, error) {
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	c := &reportConn{conn: conn, enc: json.NewEncoder(conn), transcript: transcript}
+	hello := message{Type: "hello", Version: protocolVersion, Run: runID, Debugger: debugger, DebuggerVersion: debuggerVersion}
+	if err := c.enc.Encode(hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// send sends a result.
+func (c *reportConn) send(res TestResult) error {
+	if c.transcript != nil {
+		fmt.Fprintln(c.transcript, transcriptLine(res))
+	}
+	c.sent++
+	return c.enc.Encode(message{Type: "result", TestResult: res})
+}
+
+// end sends the end-of-run message and closes the connection.
+func (c *reportConn) end() error {
+	err := c.enc.Encode(message{Type: "end", Results: c.sent})
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
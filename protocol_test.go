@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadRun(t *testing.T) {
+	const hello = `{"type": "hello", "version": 1, "run": "7", "debugger": "gdb", "debugger_version": "14.2"}` + "\n"
+	const result = `{"type": "result", "status": "PASS", "file": "x.go", "line": 3}` + "\n"
+	tests := []struct {
+		name    string
+		input   string
+		results int
+		err     string // substring of the error, or "" for success
+	}{
+		{"complete", hello + result + result + `{"type": "end", "results": 2}` + "\n", 2, ""},
+		{"empty", hello + `{"type": "end"}` + "\n", 0, ""},
+		{"truncated", hello + result, 1, "truncated"},
+		{"miscounted", hello + result + `{"type": "end", "results": 2}` + "\n", 1, "truncated"},
+		{"no handshake", "", 0, "before handshake"},
+		{"wrong version", strings.Replace(hello, `"version": 1`, `"version": 2`, 1), 0, "protocol version"},
+		{"wrong run", strings.Replace(hello, `"run": "7"`, `"run": "6"`, 1), 0, "run ID"},
+		{"result first", result, 0, "want hello"},
+		{"garbage", hello + "not json\n", 0, "bad message"},
+	}
+	for _, tt := range tests {
+		resc := make(chan TestResult, 10)
+		hello, err := readRun(strings.NewReader(tt.input), "7", "gdb", resc)
+		close(resc)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+		if len(resc) != tt.results {
+			t.Errorf("%s: got %d results, want %d", tt.name, len(resc), tt.results)
+		}
+		if tt.err == "" && hello.DebuggerVersion != "14.2" {
+			t.Errorf("%s: debugger version %q, want 14.2", tt.name, hello.DebuggerVersion)
+		}
+	}
+}
+
+// TestCollectStress runs many debugger lifecycles, some misbehaving,
+// and checks that every result is handled before collect returns.
+// Run it with -race.
+func TestCollectStress(t *testing.T) {
+	runs := 200
+	if testing.Short() {
+		runs = 20
+	}
+	dir := t.TempDir()
+	defer func(d time.Duration) { acceptGrace = d }(acceptGrace)
+	acceptGrace = 50 * time.Millisecond
+
+	// Each fake debugger sends hello, n results, and then,
+	// depending on its behavior, an end message.
+	type behavior struct {
+		name    string
+		connect bool
+		end     bool
+		fail    bool
+		errors  int // errors expected from collect and the debugger
+	}
+	behaviors := []behavior{
+		{name: "ok", connect: true, end: true},
+		{name: "truncated", connect: true, errors: 1},
+		{name: "crashed", connect: true, fail: true, errors: 2},
+		{name: "silent", errors: 1},
+		{name: "failed", connect: true, end: true, fail: true, errors: 1},
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < runs; i++ {
+				b := behaviors[i%len(behaviors)]
+				n := i % 7
+				runID := fmt.Sprintf("%d.%d", w, i)
+				sock := filepath.Join(dir, runID+".sock")
+				l, err := net.Listen("unix", sock)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				exited := make(chan struct{})
+				var runErr error
+				go func() {
+					defer close(exited)
+					if b.connect {
+						conn, err := net.Dial("unix", sock)
+						if err != nil {
+							runErr = err
+							return
+						}
+						fmt.Fprintf(conn, `{"type": "hello", "version": %d, "run": %q, "debugger": "fake"}`+"\n", protocolVersion, runID)
+						for j := 0; j < n; j++ {
+							fmt.Fprintf(conn, `{"type": "result", "status": "PASS", "line": %d}`+"\n", j)
+						}
+						if b.end {
+							fmt.Fprintf(conn, `{"type": "end", "results": %d}`+"\n", n)
+						}
+						conn.Close()
+					}
+					if b.fail {
+						runErr = fmt.Errorf("exit status 1")
+					}
+				}()
+				var passes, errors int
+				_, err = collect(l, runID, "fake", exited, func(res TestResult) {
+					if res.Line != passes {
+						t.Errorf("%s run %s: result %d out of order", b.name, runID, res.Line)
+					}
+					passes++
+				})
+				if err != nil {
+					errors++
+				}
+				<-exited
+				if runErr != nil {
+					errors++
+				}
+				wantPasses := n
+				if !b.connect {
+					wantPasses = 0
+				}
+				if passes != wantPasses || errors != b.errors {
+					t.Errorf("%s run %s: got %d passes, %d errors; want %d, %d", b.name, runID, passes, errors, wantPasses, b.errors)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
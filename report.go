@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A reporter prints the results of a single debugger run.
+type reporter struct {
+	w              io.Writer
+	name           string // debugger name
+	color          bool
+	transcriptPath string // path to the debugger transcript, if it is being kept
+	fails, errors  int
+}
+
+func newReporter(w io.Writer, name string) *reporter {
+	return &reporter{w: w, name: name, color: w == os.Stdout && isTerminal(os.Stdout)}
+}
+
+// report prints res if appropriate.
+func (r *reporter) report(res TestResult) {
+	switch res.Status {
+	case "FAIL":
+		r.fails++
+	case "ERROR":
+		r.errors++
+	}
+	// Skipped tests are shown, so that they aren't taken for coverage.
+	if res.Status != "FAIL" && res.Status != "ERROR" && res.Status != "SKIP" && !*verbose {
+		return
+	}
+	fmt.Fprintf(r.w, "[%s] %v\n", r.name, res)
+	if res.Status == "FAIL" && res.Want != nil {
+		r.diff(res.Want, res.Have)
+	}
+}
+
+// done prints where to find the full debugger transcript, if needed.
+func (r *reporter) done() {
+	if r.fails+r.errors > 0 && r.transcriptPath != "" {
+		fmt.Fprintf(r.w, "[%s] debugger transcript: %s\n", r.name, r.transcriptPath)
+	}
+}
+
+// diff prints a line-by-line diff between the wanted regular expressions
+// and the actual output. Lines that match are printed once; each regex
+// that failed to match is marked with -, and unmatched output with +.
+func (r *reporter) diff(want []string, have string) {
+	haveLines := splitLines(have)
+	res := make([]*regexp.Regexp, len(want))
+	for i, w := range want {
+		// The regexes are written for Python, but RE2 is close enough
+		// for display purposes. Fall back to literal matching.
+		re, err := regexp.Compile("^(?:" + w + ")$")
+		if err != nil {
+			re = regexp.MustCompile("^" + regexp.QuoteMeta(w) + "$")
+		}
+		res[i] = re
+	}
+
+	// Longest common subsequence, where a want line and a have line
+	// are considered equal when the regex matches.
+	n, m := len(want), len(haveLines)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case res[i].MatchString(haveLines[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && res[i].MatchString(haveLines[j]):
+			fmt.Fprintf(r.w, "    %s\n", haveLines[j])
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintln(r.w, r.paint(colorRed, "  - "+want[i]))
+			i++
+		default:
+			fmt.Fprintln(r.w, r.paint(colorGreen, "  + "+haveLines[j]))
+			j++
+		}
+	}
+}
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+func (r *reporter) paint(color, s string) string {
+	if !r.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	var buf bytes.Buffer
+	r := &reporter{w: &buf, name: "gdb"}
+	r.diff([]string{"a = 1", "b = [0-9]+", "c = true"}, "a = 1\nb = x\nc = true\nd = 4\n")
+	want := `    a = 1
+  - b = [0-9]+
+  + b = x
+    c = true
+  + d = 4
+`
+	if buf.String() != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A Target is a built test program, ready to be run in a debugger.
+type Target struct {
+	Source      string
+	RunDir      string // directory holding the executable, scripts and transcripts
+	Executable  string
+	Breakpoints []Breakpoint
+	Args        []string     // program arguments
+	Env         []string     // additions to the program's environment
+	Stdin       string       // file to use as the program's stdin, if any
+	Requires    []string     // capabilities the debuggers need to run it
+	Expect      Expect       // checked by debugo against EXIT results
+	DWARF       []DWARFCheck // checked by debugo against Executable
+	Optimized   bool         // built without -N -l, for -liveness
+	valueTests  map[int]Test // (value) tests by line, checked by debugo
+
+	// Set if Breakpoints has a CORE marker.
+	CoreExecutable string // built from a copy of Source that dumps core at the marker
+	Core           string // path of the core file
+
+	// Set if Breakpoints has an ATTACH marker.
+	AttachExecutable string // built from a copy of Source that waits at the marker
+	AttachPid        int    // set afresh for each run; 0 if it failed to start
+	attachCmd        *exec.Cmd
+
+	// Set afresh for each run under -goarch.
+	Remote     string // address of the gdbstub of the emulator running Executable
+	qemuCmd    *exec.Cmd
+	qemuExited chan error // receives qemuCmd's Wait result
+
+	// Set afresh for each run.
+	Sock     string // socket path for sending replies to
+	RunID    string // identifies the run in the protocol handshake
+	listener net.Listener
+}
+
+// A runner runs targets in debuggers.
+type runner struct {
+	goRoot  string
+	tempDir string   // for sockets
+	runs    int      // number of runs so far, for run IDs
+	diff    *differ  // for -diff, collects the results instead of checking them
+	audit   *auditor // for -audit, collects the LOCATIONS results
+
+	// For -liveness, collects the locals at each breakpoint.
+	liveness *liveness
+
+	// observe, if set, is called with each result reported.
+	observe func(debugger string, res TestResult)
+
+	// For -show-output, the number of times each test's command has
+	// been run in the current session, and the failures whose
+	// transcripts to show when it ends.
+	commandRuns map[diffKey]int
+	failures    []failure
+}
+
+// A failure is the failure of the nth run of the command of the test
+// at key, in a debugger session.
+type failure struct {
+	key diffKey
+	n   int
+}
+
+// run runs d against targets, using a single debugger process for all
+// of them. If the debugger exits partway through, it is restarted for
+// the remaining targets. Targets that require capabilities d lacks are
+// skipped. It returns an error if the targets couldn't be run at all.
+func (r *runner) run(d Debugger, targets []*Target) error {
+	var runnable []*Target
+	for _, t := range targets {
+		if m := missing(d, t.Requires); len(m) > 0 {
+			fmt.Printf("SKIPPING test %s in %s: requires %s\n", t.Source, d.Name(), strings.Join(m, ", "))
+			continue
+		}
+		runnable = append(runnable, t)
+	}
+	targets = runnable
+	for len(targets) > 0 {
+		var err error
+		if targets, err = r.session(d, targets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// session runs d against targets in a single debugger process.
+// It returns the targets left unrun because the debugger exited early,
+// or an error if it couldn't be started.
+func (r *runner) session(d Debugger, targets []*Target) (rest []*Target, err error) {
+	for i, t := range targets {
+		r.runs++
+		t.RunID = fmt.Sprint(r.runs)
+		t.Sock = filepath.Join(r.tempDir, fmt.Sprintf("run%d.sock", r.runs))
+		l, err := net.Listen("unix", t.Sock)
+		if err != nil {
+			for _, t := range targets[:i] {
+				t.listener.Close()
+			}
+			return nil, err
+		}
+		t.listener = l
+	}
+
+	// Start the programs to be attached to.
+	for _, t := range targets {
+		if t.AttachExecutable == "" {
+			continue
+		}
+		if err := startAttach(t); err != nil {
+			rep := newReporter(os.Stdout, d.Name())
+			r.report(rep, TestResult{Status: "ERROR", File: t.Source, Msg: err.Error()})
+			rep.done()
+		}
+	}
+	// Start the emulators for -goarch, which wait for the debugger.
+	for _, t := range targets {
+		if *goarch == "" || r.audit != nil {
+			continue
+		}
+		if err := startQemu(t, d.Name()); err != nil {
+			rep := newReporter(os.Stdout, d.Name())
+			r.report(rep, TestResult{Status: "ERROR", File: t.Source, Msg: "failed to start qemu: " + err.Error()})
+			rep.done()
+		}
+	}
+	defer func() {
+		for _, t := range targets {
+			stopAttach(t)
+			stopQemu(t)
+		}
+	}()
+
+	// The script and transcript live alongside the first target.
+	first := targets[0]
+	scriptPath := filepath.Join(first.RunDir, "script."+d.Name())
+	transcriptPath := filepath.Join(first.RunDir, "transcript."+d.Name())
+	dot := ScriptContext{GoRoot: r.goRoot, Protocol: protocolVersion, Targets: targets, Audit: r.audit != nil, Normalize: *normalize}
+	if err := writeScript(d, scriptPath, dot); err != nil {
+		for _, t := range targets {
+			t.listener.Close()
+		}
+		return nil, err
+	}
+
+	if *showOutput {
+		r.commandRuns, r.failures = make(map[diffKey]int), nil
+		defer func() { r.commandRuns, r.failures = nil, nil }()
+	}
+
+	exited := make(chan struct{})
+	var runErr error
+	go func() {
+		runErr = runDebugger(d, first.Executable, scriptPath, transcriptPath)
+		close(exited)
+	}()
+
+	// Errors are reported once the debugger has exited, when its
+	// transcript has been written.
+	type sessionError struct {
+		t   *Target
+		msg string
+	}
+	var errs []sessionError
+	for i, t := range targets {
+		hello, err := r.collect(d, t, exited, transcriptPath)
+		if err == nil {
+			continue
+		}
+		if i+1 == len(targets) {
+			errs = append(errs, sessionError{t, err.Error()})
+			continue
+		}
+		// Did the debugger die? If so, restart it for the remaining
+		// targets, including this one if it never got started, unless
+		// it is the first, which may be what kills the debugger.
+		select {
+		case <-exited:
+		case <-time.After(acceptGrace):
+			errs = append(errs, sessionError{t, err.Error()})
+			continue
+		}
+		rest = targets[i+1:]
+		switch {
+		case hello.Type == "" && i > 0:
+			rest = targets[i:]
+		case hello.Type == "":
+			errs = append(errs, sessionError{t, fmt.Sprintf("%v; not retried, since %s exited before running even the first target", err, d.Name())})
+		default:
+			errs = append(errs, sessionError{t, err.Error()})
+		}
+		for _, t := range rest {
+			t.listener.Close()
+		}
+		break
+	}
+
+	<-exited
+	for _, f := range r.failures {
+		if err := showTranscript(os.Stdout, d.Name(), transcriptPath, f.key.file, f.key.line, f.n); err != nil {
+			fmt.Printf("[%s] %v\n", d.Name(), err)
+		}
+	}
+	if runErr != nil {
+		errs = append(errs, sessionError{first, fmt.Sprintf("%s failed: %v", d.Name(), runErr)})
+	}
+	for _, e := range errs {
+		r.reportError(d, e.t, transcriptPath, e.msg)
+	}
+	if len(rest) > 0 {
+		fmt.Printf("[%s] restarting for the remaining %d targets\n", d.Name(), len(rest))
+	}
+	return rest, nil
+}
+
+// report reports res to rep, and to r.observe.
+func (r *runner) report(rep *reporter, res TestResult) {
+	rep.report(res)
+	if r.commandRuns != nil {
+		key := diffKey{res.File, res.Line}
+		switch res.Status {
+		case "RUNNING":
+			r.commandRuns[key]++
+		case "FAIL":
+			r.failures = append(r.failures, failure{key, r.commandRuns[key]})
+		}
+	}
+	if r.observe != nil {
+		r.observe(rep.name, res)
+	}
+}
+
+// checkDWARF reports the results of t's DWARF checks,
+// which need no debugger.
+func (r *runner) checkDWARF(t *Target) {
+	if len(t.DWARF) == 0 {
+		return
+	}
+	rep := newReporter(os.Stdout, "dwarf")
+	for _, res := range checkDWARF(t) {
+		r.report(rep, res)
+	}
+	rep.done()
+}
+
+// collect reports the results of running t in d. An error receiving them
+// is returned, for the caller to report or retry.
+func (r *runner) collect(d Debugger, t *Target, exited <-chan struct{}, transcriptPath string) (message, error) {
+	// TODO: Count to make sure we ran the expected number of tests
+	// TODO: better print of info/error messages w/ no file/lineno
+	rep := newReporter(os.Stdout, d.Name())
+	if *artifacts != "" {
+		rep.transcriptPath = transcriptPath
+	}
+	hello, err := collect(t.listener, t.RunID, d.Name(), exited, func(reply TestResult) {
+		switch {
+		case r.diff != nil && (reply.Status == "PASS" || reply.Status == "FAIL" || reply.Status == "VALUE" || reply.Status == "SKIP"):
+			r.diff.record(d.Name(), reply)
+			return
+		case r.audit != nil && reply.Status == "LOCATIONS":
+			r.audit.record(d.Name(), reply)
+			return
+		case r.liveness != nil && reply.Status == "PASS":
+			r.liveness.record(t, d.Name(), reply)
+			return
+		case reply.Status == "VALUE":
+			reply = checkValue(t.valueTests[reply.Line], reply)
+		case reply.Status == "EXIT":
+			for _, res := range checkExit(t, outputPath(t, d.Name(), "stdout"), outputPath(t, d.Name(), "stderr"), reply) {
+				r.report(rep, res)
+			}
+			return
+		case reply.Status == "ERROR" && reply.File == "":
+			reply.File = t.Source
+		}
+		r.report(rep, reply)
+	})
+	rep.done()
+	if *verbose && hello.DebuggerVersion != "" {
+		fmt.Printf("[%s] version %s, run %s\n", d.Name(), hello.DebuggerVersion, t.RunID)
+	}
+	return hello, err
+}
+
+// reportError reports an ERROR running t in d that isn't any test's.
+// The transcript at transcriptPath is named if it is being kept, or
+// else the end of the debugger's output in it is included.
+func (r *runner) reportError(d Debugger, t *Target, transcriptPath, msg string) {
+	rep := newReporter(os.Stdout, d.Name())
+	if *artifacts != "" {
+		rep.transcriptPath = transcriptPath
+	} else if tail, err := transcriptTail(transcriptPath); err == nil && tail != "" {
+		msg += "; the debugger's output ended:\n" + tail
+	}
+	r.report(rep, TestResult{Status: "ERROR", File: t.Source, Msg: msg})
+	rep.done()
+}
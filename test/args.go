@@ -0,0 +1,28 @@
+// args tests that programs get their arguments,
+// environment and stdin when run under the debuggers.
+package main
+
+//debugo:args -n 3 hello
+//debugo:env DEBUGO_GREETING=hi there
+//debugo:stdin testdata/args.txt
+
+import (
+	"bufio"
+	"flag"
+	"os"
+)
+
+func main() {
+	n := flag.Int("n", 0, "count")
+	flag.Parse()
+	count := *n
+	word := flag.Arg(0)
+	greeting := os.Getenv("DEBUGO_GREETING")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	// BREAKPOINT
+	// (value) count == 3
+	// (value) word == "hello"
+	// (value) greeting == "hi there"
+	// (value) line == "from stdin\n"
+	_, _, _, _ = count, word, greeting, line
+}
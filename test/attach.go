@@ -0,0 +1,23 @@
+// attach tests attaching the debuggers to a running Go process.
+// debugo starts the program, which waits at the ATTACH marker.
+package main
+
+type T struct {
+	Field int
+	Name  string
+}
+
+func serve(n int, t T) {
+	s := []int{n, n + 1}
+	// ATTACH
+	// (value) n == 3
+	// (value) s == []int{3, 4}
+	// (value) t == T{7, "x"}
+	// (any) print n
+	// 3
+	_ = s
+}
+
+func main() {
+	serve(3, T{Field: 7, Name: "x"})
+}
@@ -12,12 +12,12 @@ func Stack() {
 	i = 5
 	// BREAKPOINT
 	// (gdb) print i
-	// \$1 = 5
+	// \$N = 5
 	_ = i
 	b = true
 	// BREAKPOINT
 	// (gdb) print b
-	// \$2 = true
+	// \$N = true
 	_ = b
 }
 
@@ -27,9 +27,9 @@ func Heap() (*int, *bool) {
 	/* BROKEN, SKIPPED:
 	// BREAKPOINT
 	// (gdb) print i
-	// \$[0-9]+ = 5
+	// \$N = 5
 	// (gdb) print b
-	// \$[0-9]+ = false
+	// \$N = false
 	*/
 	return &i, &b
 }
@@ -0,0 +1,23 @@
+// core tests the debuggers' support for Go core files. The program
+// dumps core at the CORE marker, and the tests run against the core.
+package main
+
+type T struct {
+	Field int
+	Name  string
+}
+
+func crash(n int, t T) {
+	s := []int{n, n + 1}
+	// CORE
+	// (value) n == 3
+	// (value) s == []int{3, 4}
+	// (value) t == T{7, "x"}
+	// (any) print n
+	// 3
+	_ = s
+}
+
+func main() {
+	crash(3, T{Field: 7, Name: "x"})
+}
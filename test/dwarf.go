@@ -0,0 +1,27 @@
+// dwarf tests the debug info of the executable directly, so it needs
+// no debugger.
+package main
+
+import "fmt"
+
+type counter struct {
+	n int
+}
+
+func (c *counter) add(delta int) {
+	// DWARF var delta type=int location=present
+	c.n += delta
+}
+
+func main() {
+	// DWARF var s type=string location=present
+	// DWARF var c type=*main.counter
+	s := "hello"
+	c := &counter{}
+	for i := 0; i < 3; i++ {
+		// DWARF var i type=int location=present
+		c.add(i)
+	}
+	// DWARF line 26 is_stmt
+	fmt.Println(s, c.n)
+}
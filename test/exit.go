@@ -0,0 +1,29 @@
+// exit tests that the program runs to completion under the
+// debuggers, with the expected output and exit status.
+package main
+
+// EXPECT-EXIT 3
+// EXPECT-STDOUT counting to 3
+// EXPECT-STDOUT [123]
+// EXPECT-STDOUT [123]
+// EXPECT-STDOUT [123]
+// EXPECT-STDOUT done
+// EXPECT-STDERR
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("counting to 3")
+	n := 0
+	for n < 3 {
+		n++
+		fmt.Println(n)
+	}
+	// BREAKPOINT
+	// (value) n == 3
+	fmt.Println("done")
+	os.Exit(n)
+}
@@ -0,0 +1,22 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// arrays tests the debuggers' rendering of arrays.
+package main
+
+func main() {
+	a := [3]int{1, 2, 3}
+	strs := [2]string{"x", "y"}
+	grid := [2][2]int{{1, 2}, {3, 4}}
+	partial := [3]int{7}
+	var zero [2]bool
+	// BREAKPOINT
+	// (value) a == [3]int{1, 2, 3}
+	// (value) strs == [2]string{"x", "y"}
+	// (value) grid == [2][2]int{[2]int{1, 2}, [2]int{3, 4}}
+	// (value) partial == [3]int{7, 0, 0}
+	// (value) zero == [2]bool{false, false}
+	use(a, strs, grid, partial, zero)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
@@ -0,0 +1,20 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// channels tests the debuggers' rendering of channels.
+package main
+
+func main() {
+	ch := make(chan int)
+	buffered := make(chan string, 2)
+	var nilChan chan int
+	// BREAKPOINT
+	// (any) print ch
+	// .*0x[0-9a-f]+.*
+	// (any) print buffered
+	// .*0x[0-9a-f]+.*
+	// (value) nilChan == nil
+	use(ch, buffered, nilChan)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
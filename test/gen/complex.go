@@ -0,0 +1,18 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// complex tests the debuggers' rendering of complex numbers.
+package main
+
+func main() {
+	c64 := complex64(1 + 2i)
+	c128 := complex(3.5, -1)
+	var zero complex128
+	// BREAKPOINT
+	// (value) c64 == (1 + 2i)
+	// (value) c128 == (3.5 + -1i)
+	// (value) zero == 0
+	use(c64, c128, zero)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
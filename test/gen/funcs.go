@@ -0,0 +1,22 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// funcs tests the debuggers' rendering of func values.
+package main
+
+func double(x int) int { return 2 * x }
+
+func main() {
+	f := double
+	closure := func(a, b int) int { return a + b }
+	var nilFunc func()
+	// BREAKPOINT
+	// (any) print f
+	// .*0x[0-9a-f]+.*
+	// (any) print closure
+	// .*0x[0-9a-f]+.*
+	// (value) nilFunc == nil
+	use(f, closure, nilFunc)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
@@ -0,0 +1,27 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// generics tests the debuggers' rendering of instances of generic types.
+package main
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+type List[T any] struct{ Items []T }
+
+func main() {
+	p := Pair[string, int]{"a", 1}
+	l := List[float64]{Items: []float64{1.5, 2}}
+	ptr := &Pair[int, bool]{Key: 1, Val: true}
+	var zero Pair[string, []int]
+	// BREAKPOINT
+	// (value) p == Pair[string, int]{Key: "a", Val: 1}
+	// (value) l == List[float64]{Items: []float64{1.5, 2}}
+	// (value) ptr == &Pair[int, bool]{Key: 1, Val: true}
+	// (value) zero == Pair[string, []int]{Key: "", Val: nil}
+	use(p, l, ptr, zero)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
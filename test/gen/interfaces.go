@@ -0,0 +1,30 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// interfaces tests the debuggers' rendering of interfaces.
+package main
+
+type Shape interface{ Area() int }
+
+type Square struct{ Side int }
+
+func (s Square) Area() int { return s.Side * s.Side }
+
+func main() {
+	var i interface{} = 7
+	var s interface{} = "x"
+	var shape Shape = Square{2}
+	var ptr interface{} = &Square{3}
+	var nilIface interface{}
+	var nilShape Shape
+	// BREAKPOINT
+	// (value) i == 7
+	// (value) s == "x"
+	// (value) shape == Square{Side: 2}
+	// (value) ptr == &Square{Side: 3}
+	// (value) nilIface == nil
+	// (value) nilShape == nil
+	use(i, s, shape, ptr, nilIface, nilShape)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
@@ -0,0 +1,22 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// maps tests the debuggers' rendering of maps.
+package main
+
+func main() {
+	m := map[string]int{"a": 1, "b": 2}
+	byInt := map[int]string{1: "one"}
+	nested := map[string][]int{"x": {1, 2}}
+	empty := map[string]bool{}
+	var nilMap map[string]int
+	// BREAKPOINT
+	// (value) m == map[string]int{"a": 1, "b": 2}
+	// (value) byInt == map[int]string{1: "one"}
+	// (value) nested == map[string][]int{"x": []int{1, 2}}
+	// (value) empty == map[string]bool{}
+	// (value) nilMap == nil
+	use(m, byInt, nested, empty, nilMap)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
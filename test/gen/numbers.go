@@ -0,0 +1,46 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// numbers tests the debuggers' rendering of integers, floats and booleans.
+package main
+
+func main() {
+	i := -5
+	i8 := int8(-8)
+	i16 := int16(1600)
+	i32 := int32(-32)
+	i64 := int64(1) << 40
+	u := uint(7)
+	u8 := uint8(255)
+	u16 := uint16(65535)
+	u32 := uint32(1) << 31
+	u64 := uint64(1) << 63
+	up := uintptr(0x1000)
+	f32 := float32(1.5)
+	f64 := -0.25
+	t := true
+	var f bool
+	r := 'x'
+	b := byte('A')
+	// BREAKPOINT
+	// (value) i == -5
+	// (value) i8 == -8
+	// (value) i16 == 1600
+	// (value) i32 == -32
+	// (value) i64 == 1099511627776
+	// (value) u == 7
+	// (value) u8 == 255
+	// (value) u16 == 65535
+	// (value) u32 == 2147483648
+	// (value) u64 == 9223372036854775808
+	// (value) up == 4096
+	// (value) f32 == 1.5
+	// (value) f64 == -0.25
+	// (value) t == true
+	// (value) f == false
+	// (value) r == 120
+	// (value) b == 65
+	use(i, i8, i16, i32, i64, u, u8, u16, u32, u64, up, f32, f64, t, f, r, b)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
@@ -0,0 +1,27 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// pointers tests the debuggers' rendering of pointers.
+package main
+
+type T struct {
+	I int
+	S string
+}
+
+func main() {
+	n := 42
+	p := &n
+	pp := &p
+	pt := &T{1, "a"}
+	var nilPtr *int
+	// BREAKPOINT
+	// (value) n == 42
+	// (value) p == &42
+	// (value) pp == &(&42)
+	// (value) pt == &T{I: 1, S: "a"}
+	// (value) nilPtr == nil
+	use(n, p, pp, pt, nilPtr)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
@@ -0,0 +1,24 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// slices tests the debuggers' rendering of slices.
+package main
+
+func main() {
+	ints := []int{1, 2, 3}
+	strs := []string{"a", "b"}
+	nested := [][]int{{1}, {2, 3}}
+	bytes := []byte{'h', 'i'}
+	empty := []int{}
+	var nilSlice []int
+	// BREAKPOINT
+	// (value) ints == []int{1, 2, 3}
+	// (value) strs == []string{"a", "b"}
+	// (value) nested == [][]int{[]int{1}, []int{2, 3}}
+	// (value) bytes == []byte{104, 105}
+	// (value) empty == []int{}
+	// (value) nilSlice == nil
+	use(ints, strs, nested, bytes, empty, nilSlice)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
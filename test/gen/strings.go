@@ -0,0 +1,20 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// strings tests the debuggers' rendering of strings.
+package main
+
+func main() {
+	s := "hello"
+	empty := ""
+	unicode := "héllo, 世界"
+	escapes := "a\nb\t\"c\""
+	// BREAKPOINT
+	// (value) s == "hello"
+	// (value) empty == ""
+	// (value) unicode == "héllo, 世界"
+	// (value) escapes == "a\nb\t\"c\""
+	use(s, empty, unicode, escapes)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
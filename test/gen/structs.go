@@ -0,0 +1,36 @@
+// Code generated by debugo gen; DO NOT EDIT.
+
+// structs tests the debuggers' rendering of structs.
+package main
+
+type T struct {
+	I int
+	S string
+	F float64
+}
+
+type Outer struct {
+	T T
+	P *T
+	L []int
+}
+
+func main() {
+	t := T{1, "a", 1.5}
+	keyed := T{S: "b"}
+	outer := Outer{T: T{2, "x", 0}, P: &T{3, "y", 0}, L: []int{4}}
+	empty := struct{}{}
+	anon := struct{ X, Y int }{1, 2}
+	var zero T
+	// BREAKPOINT
+	// (value) t == T{I: 1, S: "a", F: 1.5}
+	// (value) keyed == T{I: 0, S: "b", F: 0}
+	// (value) outer == Outer{T: T{I: 2, S: "x", F: 0}, P: &T{I: 3, S: "y", F: 0}, L: []int{4}}
+	// (value) empty == struct{}{}
+	// (value) anon == struct{X int; Y int}{X: 1, Y: 2}
+	// (value) zero == T{I: 0, S: "", F: 0}
+	use(t, keyed, outer, empty, anon, zero)
+}
+
+// use keeps variables live at the BREAKPOINT.
+func use(...interface{}) {}
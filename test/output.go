@@ -0,0 +1,24 @@
+// output tests that output without a final newline, written just
+// before a breakpoint, doesn't get in the way of the debuggers.
+package main
+
+// EXPECT-EXIT 0
+// EXPECT-STDOUT xy
+// EXPECT-STDERR e
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Print("x")
+	fmt.Fprint(os.Stderr, "e")
+	n := 1
+	// BREAKPOINT
+	// (value) n == 1
+	// (any) print n
+	// 1
+	fmt.Print("y")
+	_ = n
+}
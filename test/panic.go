@@ -0,0 +1,25 @@
+// panic tests the debuggers' support for stopping a Go program
+// as it panics. The tests run in the frame that panics.
+package main
+
+// EXPECT-EXIT 2
+
+type T struct {
+	Field int
+	Name  string
+}
+
+func index(s []int, i int, t T) int {
+	n := len(s)
+	// PANIC
+	// (value) i == 5
+	// (value) n == 2
+	// (value) t == T{7, "x"}
+	// (any) print i
+	// 5
+	return s[i] + n
+}
+
+func main() {
+	index([]int{1, 2}, 5, T{Field: 7, Name: "x"})
+}
@@ -0,0 +1,29 @@
+// portable runs the same (any) checks in every debugger.
+package main
+
+type T struct {
+	Field int
+	Name  string
+}
+
+func Frame(i int) {
+	b := true
+	t := T{Field: 1, Name: "x"}
+	// BREAKPOINT
+	// (any) print b
+	// true
+	// (any) print t
+	// {Field = 1, Name = "x"}
+	// (any) locals
+	// b = true
+	// t = {Field = 1, Name = "x"}
+	// (any) bt
+	// #0 main.Frame at portable.go:24
+	// #1 main.main at portable.go:28
+	// [\s\S]*
+	_, _ = b, t
+}
+
+func main() {
+	Frame(3)
+}
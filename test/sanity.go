@@ -10,9 +10,9 @@ package main
 func main() {
 	// BREAKPOINT
 	// (gdb) print 1
-	// \$1 = 1
+	// \$N = 1
 	// (lldb) print 2
-	// \(int\) \$0 = 2
+	// \(int\) \$N = 2
 	_ = 42
 	// Need at least one statement above, on pain of test failures.
 	// This might be an edge case bug in Go's DWARF generation.
@@ -0,0 +1,25 @@
+// signal tests the debuggers' support for stopping a Go program when
+// it receives a signal. The tests run in the frame that faults.
+package main
+
+// EXPECT-EXIT 2
+
+type T struct {
+	Field int
+	Name  string
+}
+
+func deref(p *T, n int) int {
+	s := []int{n, n + 1}
+	// SIGNAL SIGSEGV
+	// (value) n == 3
+	// (value) s == []int{3, 4}
+	// (value) p == nil
+	// (any) print n
+	// 3
+	return p.Field + s[0]
+}
+
+func main() {
+	deref(nil, 3)
+}
@@ -0,0 +1,22 @@
+// values tests the debuggers' rendering of composite
+// values, using debugger-agnostic (value) assertions.
+package main
+
+type T struct {
+	Field int
+	Name  string
+}
+
+func main() {
+	s := []int{1, 2, 3}
+	m := map[string]T{"k": {Field: 7, Name: "x"}}
+	p := &T{Field: 1}
+	// BREAKPOINT
+	// (value) s == []int{1, 2, 3}
+	// (value) s[2] == 3
+	// (value) m["k"].Field == 7
+	// (value) m == map[string]T{"k": T{Field: 7, Name: "x"}}
+	// (value) p.Name == ""
+	// (value) *p == T{1, ""}
+	_, _, _ = s, m, p
+}
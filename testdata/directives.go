@@ -0,0 +1,18 @@
+package main
+
+//debugo:args -v x
+//debugo:args 'y z' ""
+//debugo:env A=1
+//debugo:env B=two words
+//debugo:stdin in.txt
+//debugo:requires gdb-python gdb-go
+
+// EXPECT-EXIT 3
+// EXPECT-STDOUT hello
+// EXPECT-STDOUT
+
+func main() {
+	// BREAKPOINT
+	// (gdb) print 1
+	// want
+}
@@ -25,3 +25,33 @@ func InlineComments() {
 func main() {
 	// Non-breakpoint comment.
 }
+
+func Portable() {
+	// BREAKPOINT
+	// (any) print x
+	// want5
+	// (value) s[1] == []int{1, 2}
+	// (any) locals
+	// want6
+	// (dap) x + 1
+	// want7
+}
+
+func Core() {
+	// CORE
+	// (gdb) bt
+	// want8
+}
+
+func Attach() {
+	// ATTACH
+	// (lldb) bt
+	// want9
+}
+
+func Panic() {
+	// PANIC
+	// (gdb) bt
+	// want10
+	panic("x")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// transcriptContext is the number of commands shown on either side
+// of a failing command by -show-output.
+const transcriptContext = 3
+
+// runDebugger runs d, capturing its output, stdout and stderr interleaved,
+// and exit status into a transcript at transcriptPath.
+func runDebugger(d Debugger, executable, scriptPath, transcriptPath string) error {
+	var output bytes.Buffer
+	both := &lockedWriter{w: &output}
+	var outw, errw io.Writer = both, both
+	if *debug {
+		outw = io.MultiWriter(outw, os.Stdout)
+		errw = io.MultiWriter(errw, os.Stderr)
+	}
+	runErr := d.Run(executable, scriptPath, outw, errw)
+
+	f, err := os.Create(transcriptPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, "debugger: %s\nexecutable: %s\nscript: %s\n", d.Name(), executable, scriptPath)
+	fmt.Fprintf(f, "\n%s\n%s", transcriptOutput, output.Bytes())
+	fmt.Fprintf(f, "\n--- exit status: %s ---\n", exitStatus(runErr))
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// transcriptOutput heads the debugger's output in a transcript.
+const transcriptOutput = "--- stdout and stderr ---"
+
+// A lockedWriter serializes writes to w, which both the debugger's
+// stdout and stderr go to.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// transcriptLine is the line written to the transcript for each result
+// sent, by the scripts and the backends implemented in Go alike, which
+// marks where each command was run.
+func transcriptLine(res TestResult) string {
+	return fmt.Sprintf("[debugo] %s %s:%d %s", res.Status, res.File, res.Line, strings.Replace(res.Msg, "\n", " ", -1))
+}
+
+// transcriptOutputLines returns the lines of the debugger's output in
+// the transcript at path, without trailing blank lines.
+func transcriptOutputLines(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(string(b))
+	start, end := 0, len(lines)
+	for i, l := range lines {
+		switch {
+		case l == transcriptOutput:
+			start = i + 1
+		case strings.HasPrefix(l, "--- exit status:"):
+			end = i
+		}
+	}
+	lines = lines[start:end]
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
+
+// transcriptTailLines is the number of lines of the debugger's output
+// included in an ERROR when the transcript isn't kept.
+const transcriptTailLines = 10
+
+// transcriptTail returns the last transcriptTailLines lines of the
+// debugger's output in the transcript at path.
+func transcriptTail(path string) (string, error) {
+	lines, err := transcriptOutputLines(path)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) > transcriptTailLines {
+		lines = lines[len(lines)-transcriptTailLines:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// showTranscript prints the debugger's output in the transcript at path
+// around the nth run (counting from 1) of the command of the test at
+// file:line, from transcriptContext commands before it to
+// transcriptContext after.
+func showTranscript(w io.Writer, debugger, path, file string, line, n int) error {
+	lines, err := transcriptOutputLines(path)
+	if err != nil {
+		return err
+	}
+
+	// The commands are marked by their RUNNING results.
+	var commands []int
+	failing := -1
+	prefix := transcriptLine(TestResult{Status: "RUNNING", File: file, Line: line})
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "[debugo] RUNNING ") {
+			continue
+		}
+		if strings.HasPrefix(l, prefix) {
+			if n--; n == 0 {
+				failing = len(commands)
+			}
+		}
+		commands = append(commands, i)
+	}
+	if failing < 0 {
+		return fmt.Errorf("no command for %s:%d in %s", file, line, path)
+	}
+	start, end := 0, len(lines)
+	if failing > transcriptContext {
+		start = commands[failing-transcriptContext]
+	}
+	if failing+transcriptContext+1 < len(commands) {
+		end = commands[failing+transcriptContext+1]
+	}
+	fmt.Fprintf(w, "[%s] transcript around %s:%d:\n", debugger, file, line)
+	for i := start; i < end; i++ {
+		mark := " "
+		if i == commands[failing] {
+			mark = ">"
+		}
+		fmt.Fprintf(w, "%s %s\n", mark, lines[i])
+	}
+	return nil
+}
+
+// exitStatus describes the outcome of a command run.
+func exitStatus(err error) string {
+	if err == nil {
+		return "0"
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ProcessState.String()
+	}
+	return err.Error()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestShowTranscript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.gdb")
+	transcript := `debugger: gdb
+executable: x
+script: script.gdb
+
+--- stdout and stderr ---
+[debugo] RUNNING x.go:5 print a
+1
+[debugo] PASS x.go:5 
+warning: something
+[debugo] RUNNING x.go:6 print b
+[debugo] ERROR x.go:6 command print b failed
+[debugo] RUNNING x.go:5 print a
+2
+[debugo] FAIL x.go:5 output did not match
+[debugo] RUNNING x.go:7 print c
+3
+
+--- exit status: 0 ---
+`
+	if err := ioutil.WriteFile(path, []byte(transcript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := showTranscript(&buf, "gdb", path, "x.go", 5, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := `[gdb] transcript around x.go:5:
+  [debugo] RUNNING x.go:5 print a
+  1
+  [debugo] PASS x.go:5 
+  warning: something
+  [debugo] RUNNING x.go:6 print b
+  [debugo] ERROR x.go:6 command print b failed
+> [debugo] RUNNING x.go:5 print a
+  2
+  [debugo] FAIL x.go:5 output did not match
+  [debugo] RUNNING x.go:7 print c
+  3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if err := showTranscript(&buf, "gdb", path, "x.go", 5, 3); err == nil {
+		t.Errorf("showTranscript of a third run succeeded, want error")
+	}
+}
+
+func TestTranscriptTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.gdb")
+	transcript := "debugger: gdb\n\n--- stdout and stderr ---\n"
+	for i := 1; i <= 12; i++ {
+		transcript += fmt.Sprintf("line %d\n", i)
+	}
+	transcript += "\n--- exit status: exit status 1 ---\n"
+	if err := ioutil.WriteFile(path, []byte(transcript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := transcriptTail(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "line 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 10\nline 11\nline 12"; tail != want {
+		t.Errorf("transcriptTail = %q, want %q", tail, want)
+	}
+}
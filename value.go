@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// Value is a debugger-agnostic rendering of a Go value.
+// The debugger scripts send one back for each (value) test.
+type Value struct {
+	Kind     string  `json:"kind"` // "scalar", "string", "list", "map", "struct", "pointer", "interface", "nil"
+	Type     string  `json:"type,omitempty"`
+	Value    string  `json:"value,omitempty"`    // scalar and string values
+	Children []Child `json:"children,omitempty"` // elements, fields, entries, pointees
+}
+
+// Child is an element of a list, field of a struct, entry in a map,
+// or target of a pointer or interface.
+type Child struct {
+	Name  string `json:"name,omitempty"` // struct field name
+	Key   *Value `json:"key,omitempty"`  // map key
+	Value *Value `json:"value"`
+}
+
+func (v *Value) String() string { return v.format(true) }
+
+// untypedString renders v without type names, which differ between
+// debuggers, as matchValue ignores them.
+func (v *Value) untypedString() string { return v.format(false) }
+
+// format renders v, with its composite literals' type names if typed.
+func (v *Value) format(typed bool) string {
+	switch v.Kind {
+	case "scalar":
+		return v.Value
+	case "string":
+		return strconv.Quote(v.Value)
+	case "nil":
+		return "nil"
+	}
+	var elems []string
+	for _, c := range v.Children {
+		switch {
+		case c.Key != nil:
+			elems = append(elems, c.Key.format(typed)+": "+c.Value.format(typed))
+		case c.Name != "":
+			elems = append(elems, c.Name+": "+c.Value.format(typed))
+		default:
+			elems = append(elems, c.Value.format(typed))
+		}
+	}
+	switch v.Kind {
+	case "pointer":
+		return "&" + strings.Join(elems, "")
+	case "interface":
+		return strings.Join(elems, "")
+	}
+	if !typed {
+		return "{" + strings.Join(elems, ", ") + "}"
+	}
+	return v.Type + "{" + strings.Join(elems, ", ") + "}"
+}
+
+// ParseValueTest splits a (value) assertion such as
+// `m["k"].Field == 7` into its left and right hand sides.
+func ParseValueTest(s string) (expr, want string, err error) {
+	x, err := parser.ParseExpr(s)
+	if err != nil {
+		return "", "", err
+	}
+	bin, ok := x.(*ast.BinaryExpr)
+	if !ok || bin.Op != token.EQL {
+		return "", "", fmt.Errorf("want <expr> == <value>, have %q", s)
+	}
+	// Positions returned by ParseExpr are 1-based offsets into s.
+	lhs := strings.TrimSpace(s[bin.X.Pos()-1 : bin.X.End()-1])
+	rhs := strings.TrimSpace(s[bin.Y.Pos()-1 : bin.Y.End()-1])
+	if _, err := valueRoot(bin.X); err != nil {
+		return "", "", err
+	}
+	return lhs, rhs, nil
+}
+
+// ValueRoot returns the variable that must be evaluated by the
+// debugger to check t, a (value) test.
+func (t Test) ValueRoot() (string, error) {
+	x, err := parser.ParseExpr(t.Command)
+	if err != nil {
+		return "", err
+	}
+	return valueRoot(x)
+}
+
+// valueRoot returns the root identifier of a selector, index
+// and dereference expression such as *m["k"].Field.
+func valueRoot(x ast.Expr) (string, error) {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Name, nil
+	case *ast.SelectorExpr:
+		return valueRoot(x.X)
+	case *ast.IndexExpr:
+		return valueRoot(x.X)
+	case *ast.StarExpr:
+		return valueRoot(x.X)
+	case *ast.ParenExpr:
+		return valueRoot(x.X)
+	}
+	return "", fmt.Errorf("unsupported expression %T; want a variable followed by selectors, indexes and dereferences", x)
+}
+
+// checkValue converts a VALUE result for t into a PASS or FAIL.
+func checkValue(t Test, res TestResult) TestResult {
+	res.Status = "FAIL"
+	if res.Value == nil {
+		res.Msg = "no value received for " + t.Command
+		return res
+	}
+	x, err := parser.ParseExpr(t.Command)
+	if err != nil {
+		res.Msg = err.Error()
+		return res
+	}
+	v, err := selectValue(res.Value, x)
+	if err != nil {
+		res.Msg = fmt.Sprintf("%s: %v", t.Command, err)
+		return res
+	}
+	want, err := parser.ParseExpr(strings.Join(t.Want, "\n"))
+	if err != nil {
+		res.Msg = err.Error()
+		return res
+	}
+	if err := matchValue(v, want); err != nil {
+		res.Msg = fmt.Sprintf("%s: %v; have %v", t.Command, err, v)
+		return res
+	}
+	res.Status = "PASS"
+	res.Msg = ""
+	res.Value = nil
+	return res
+}
+
+// selectValue applies the selectors, indexes and dereferences in x to root,
+// which holds the value of x's root identifier.
+func selectValue(root *Value, x ast.Expr) (*Value, error) {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return root, nil
+	case *ast.ParenExpr:
+		return selectValue(root, x.X)
+	case *ast.StarExpr:
+		v, err := selectValue(root, x.X)
+		if err != nil {
+			return nil, err
+		}
+		v = unwrap(v)
+		if v.Kind != "pointer" || len(v.Children) != 1 {
+			return nil, fmt.Errorf("cannot dereference %v", v)
+		}
+		return v.Children[0].Value, nil
+	case *ast.SelectorExpr:
+		v, err := selectValue(root, x.X)
+		if err != nil {
+			return nil, err
+		}
+		v = deref(v)
+		for _, c := range v.Children {
+			if c.Name == x.Sel.Name {
+				return c.Value, nil
+			}
+		}
+		return nil, fmt.Errorf("no field %s in %v", x.Sel.Name, v)
+	case *ast.IndexExpr:
+		v, err := selectValue(root, x.X)
+		if err != nil {
+			return nil, err
+		}
+		v = deref(v)
+		switch v.Kind {
+		case "list":
+			c, err := constValue(x.Index)
+			if err != nil {
+				return nil, err
+			}
+			i, ok := constant.Int64Val(constant.ToInt(c))
+			if !ok || i < 0 || i >= int64(len(v.Children)) {
+				return nil, fmt.Errorf("index %v out of range [0:%d]", c, len(v.Children))
+			}
+			return v.Children[i].Value, nil
+		case "map":
+			for _, c := range v.Children {
+				if c.Key != nil && matchValue(c.Key, x.Index) == nil {
+					return c.Value, nil
+				}
+			}
+			return nil, fmt.Errorf("no key %s in %v", exprString(x.Index), v)
+		}
+		return nil, fmt.Errorf("cannot index %v", v)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", x)
+}
+
+// matchValue reports whether v matches want, a Go expression.
+// Composite literals are compared element by element, ignoring
+// type names, which differ between debuggers.
+func matchValue(v *Value, want ast.Expr) error {
+	return matchElem(v, want, nil)
+}
+
+// matchElem is matchValue for want, an element of a composite literal
+// whose element type is typ, or nil if unknown. Composite literals
+// among the elements may elide typ.
+func matchElem(v *Value, want ast.Expr, typ ast.Expr) error {
+	v = unwrap(v)
+	switch w := want.(type) {
+	case *ast.ParenExpr:
+		return matchElem(v, w.X, typ)
+	case *ast.Ident:
+		switch w.Name {
+		case "nil":
+			// An empty slice or map is not nil.
+			if v.Kind == "nil" {
+				return nil
+			}
+			return fmt.Errorf("want nil")
+		case "true", "false":
+			if v.Kind == "scalar" && v.Value == w.Name {
+				return nil
+			}
+			return fmt.Errorf("want %s", w.Name)
+		}
+	case *ast.UnaryExpr:
+		if w.Op == token.AND {
+			if v.Kind != "pointer" || len(v.Children) != 1 {
+				return fmt.Errorf("want pointer to %s", exprString(w.X))
+			}
+			return matchValue(v.Children[0].Value, w.X)
+		}
+	case *ast.CompositeLit:
+		if w.Type != nil {
+			return matchComposite(v, w, w.Type)
+		}
+		// {...} for an element of type *T is &T{...}.
+		if star, ok := typ.(*ast.StarExpr); ok {
+			if v.Kind != "pointer" || len(v.Children) != 1 {
+				return fmt.Errorf("want pointer to %s", exprString(w))
+			}
+			return matchComposite(unwrap(v.Children[0].Value), w, star.X)
+		}
+		return matchComposite(v, w, typ)
+	}
+
+	c, err := constValue(want)
+	if err != nil {
+		return err
+	}
+	if c.Kind() == constant.String {
+		if v.Kind != "string" || v.Value != constant.StringVal(c) {
+			return fmt.Errorf("want %s", c)
+		}
+		return nil
+	}
+	if v.Kind != "scalar" {
+		return fmt.Errorf("want %s", c)
+	}
+	have, err := constValue(v.Value)
+	if err != nil || have.Kind() == constant.String || have.Kind() == constant.Bool {
+		return fmt.Errorf("want %s", c)
+	}
+	if !constant.Compare(have, token.EQL, c) {
+		return fmt.Errorf("want %s", c)
+	}
+	return nil
+}
+
+// matchComposite matches v against w, a composite literal of type typ.
+// A named or unknown type is taken to be of v's kind, if that is a kind
+// of composite; the elements are checked all the same.
+func matchComposite(v *Value, w *ast.CompositeLit, typ ast.Expr) error {
+	var kind string
+	var keyType, elemType ast.Expr
+	switch t := typ.(type) {
+	case *ast.ArrayType:
+		kind, elemType = "list", t.Elt
+	case *ast.MapType:
+		kind, keyType, elemType = "map", t.Key, t.Value
+	case *ast.StructType:
+		kind = "struct"
+	default:
+		kind = "struct"
+		if v.Kind == "list" || v.Kind == "map" {
+			kind = v.Kind
+		}
+	}
+	if v.Kind != kind {
+		return fmt.Errorf("want %s %s, have %s", kind, exprString(w), v.Kind)
+	}
+	if kind != "struct" && len(v.Children) != len(w.Elts) {
+		return fmt.Errorf("want %d elements, have %d", len(w.Elts), len(v.Children))
+	}
+	// As in Go, a struct literal either names its fields or gives them all
+	// in order.
+	positional := false
+	if kind == "struct" && len(w.Elts) > 0 {
+		if _, keyed := w.Elts[0].(*ast.KeyValueExpr); !keyed {
+			positional = true
+			if len(w.Elts) != len(v.Children) {
+				return fmt.Errorf("want %d fields, have %d", len(w.Elts), len(v.Children))
+			}
+		}
+	}
+	for i, elt := range w.Elts {
+		kv, keyed := elt.(*ast.KeyValueExpr)
+		switch {
+		case kind == "struct" && keyed == positional:
+			return fmt.Errorf("mixture of field:value and value elements in %s", exprString(w))
+		case kind == "map":
+			if !keyed {
+				return fmt.Errorf("map element %s has no key", exprString(elt))
+			}
+			found := false
+			for _, c := range v.Children {
+				if c.Key != nil && matchElem(c.Key, kv.Key, keyType) == nil {
+					if err := matchElem(c.Value, kv.Value, elemType); err != nil {
+						return fmt.Errorf("[%s]: %v", exprString(kv.Key), err)
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("no key %s", exprString(kv.Key))
+			}
+		case keyed && kind == "struct":
+			name, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return fmt.Errorf("bad field name %s", exprString(kv.Key))
+			}
+			found := false
+			for _, c := range v.Children {
+				if c.Name == name.Name {
+					if err := matchValue(c.Value, kv.Value); err != nil {
+						return fmt.Errorf(".%s: %v", name.Name, err)
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("no field %s", name.Name)
+			}
+		case keyed:
+			return fmt.Errorf("keyed %s elements are not supported", kind)
+		default:
+			if err := matchElem(v.Children[i].Value, elt, elemType); err != nil {
+				return fmt.Errorf("[%d]: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// unwrap returns the dynamic value held by an interface.
+func unwrap(v *Value) *Value {
+	for v.Kind == "interface" && len(v.Children) == 1 {
+		v = v.Children[0].Value
+	}
+	return v
+}
+
+// deref follows pointers, as Go does for selectors and indexes.
+func deref(v *Value) *Value {
+	v = unwrap(v)
+	for v.Kind == "pointer" && len(v.Children) == 1 {
+		v = unwrap(v.Children[0].Value)
+	}
+	return v
+}
+
+// constValue evaluates a constant expression, given as a string or an ast.Expr.
+func constValue(x interface{}) (constant.Value, error) {
+	var src string
+	switch x := x.(type) {
+	case string:
+		src = x
+	case ast.Expr:
+		src = exprString(x)
+	}
+	tv, err := types.Eval(token.NewFileSet(), nil, token.NoPos, src)
+	if err != nil {
+		return nil, err
+	}
+	if tv.Value == nil {
+		return nil, fmt.Errorf("%s is not a constant", src)
+	}
+	return tv.Value, nil
+}
+
+func exprString(x ast.Expr) string {
+	return types.ExprString(x)
+}
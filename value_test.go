@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func scalar(s string) *Value { return &Value{Kind: "scalar", Value: s} }
+
+func TestCheckValue(t *testing.T) {
+	slice := &Value{Kind: "list", Children: []Child{{Value: scalar("1")}, {Value: scalar("2")}, {Value: scalar("3")}}}
+	m := &Value{Kind: "map", Children: []Child{{
+		Key: &Value{Kind: "string", Value: "k"},
+		Value: &Value{Kind: "pointer", Children: []Child{{Value: &Value{Kind: "struct", Children: []Child{
+			{Name: "Field", Value: scalar("7")},
+			{Name: "Name", Value: &Value{Kind: "string", Value: "x"}},
+		}}}}},
+	}}}
+	list := func(elems ...*Value) *Value {
+		v := &Value{Kind: "list"}
+		for _, e := range elems {
+			v.Children = append(v.Children, Child{Value: e})
+		}
+		return v
+	}
+	nested := list(list(scalar("1")), list(scalar("2")))
+	lists := &Value{Kind: "map", Children: []Child{{Key: &Value{Kind: "string", Value: "a"}, Value: list(scalar("1"))}}}
+
+	tests := []struct {
+		assert string
+		value  *Value
+		pass   bool
+	}{
+		{`s == []int{1, 2, 3}`, slice, true},
+		{`s == []int{1, 2}`, slice, false},
+		{`s[1] == 2`, slice, true},
+		{`s[1] == 2.0`, slice, true},
+		{`s[3] == 2`, slice, false},
+		{`m["k"].Field == 7`, m, true},
+		{`m["k"].Field == 8`, m, false},
+		{`m["k"].Name == "x"`, m, true},
+		{`*m["k"] == T{Field: 7}`, m, true},
+		{`m == map[string]*T{"k": &T{7, "x"}}`, m, true},
+		{`m["j"] == nil`, m, false},
+		{`m == map[string]*T{"k": {7, "x"}}`, m, true},
+		{`m == map[string]*T{"k": {7}}`, m, false},
+		{`*m["k"] == T{7, Name: "x"}`, m, false},
+		{`n == [][]int{{1}, {2}}`, nested, true},
+		{`n == [][]int{{1}, {3}}`, nested, false},
+		{`l == map[string][]int{"a": {1}}`, lists, true},
+		{`s == S{1, 2, 3}`, slice, true},
+		{`s == nil`, list(), false},
+		{`s == []int{}`, list(), true},
+		{`s == []int{}`, &Value{Kind: "nil"}, false},
+		{`b == true`, scalar("true"), true},
+		{`c == 1 + 2i`, scalar("1 + 2i"), true},
+		{`p == nil`, &Value{Kind: "nil"}, true},
+		{`e == 5`, &Value{Kind: "interface", Children: []Child{{Value: scalar("5")}}}, true},
+	}
+	for _, tt := range tests {
+		expr, want, err := ParseValueTest(tt.assert)
+		if err != nil {
+			t.Errorf("ParseValueTest(%q): %v", tt.assert, err)
+			continue
+		}
+		res := checkValue(Test{Debugger: "value", Command: expr, Want: []string{want}}, TestResult{Status: "VALUE", Value: tt.value})
+		if pass := res.Status == "PASS"; pass != tt.pass {
+			t.Errorf("%s: got %s %s, want pass=%v", tt.assert, res.Status, res.Msg, tt.pass)
+		}
+	}
+}
+
+func TestParseValueTest(t *testing.T) {
+	for _, bad := range []string{`s`, `s != 1`, `f(x) == 1`, `s ==`} {
+		if _, _, err := ParseValueTest(bad); err == nil {
+			t.Errorf("ParseValueTest(%q) succeeded, want error", bad)
+		}
+	}
+}